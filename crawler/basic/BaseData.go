@@ -1,6 +1,14 @@
 package basic
 
-import "net/http"
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
 
 type BaseData interface {
 	IsValid() bool // Is this data valid.
@@ -10,10 +18,35 @@ type DownloadRequest struct {
 	id uint64
 	httpRequest *http.Request
 	depth uint32
+	score float64 // 优先级得分，由请求缓存的评分函数计算。
+	parentScore float64 // 父页面请求的得分。
+	attempt uint32 // 已经尝试下载的次数。
+	notBefore time.Time // 重试的请求在此时间之前不会被发送。
+	redirects int // 加入请求缓存的重定向目标已经过的重定向次数。
+	spec *RequestSpec // 可序列化的请求描述，每次尝试都由它重新创建HTTP请求。
 }
 
+// 创建请求，HTTP请求的请求体会被读出保存在请求描述中。
 func NewDownloadRequest(id uint64,httpRequest *http.Request,depth uint32) *DownloadRequest{
-	return &DownloadRequest{id:id,httpRequest:httpRequest,depth:depth}
+	req:=&DownloadRequest{id:id,httpRequest:httpRequest,depth:depth}
+	if httpRequest!=nil {
+		req.spec=newRequestSpecFrom(httpRequest)
+	}
+	return req
+}
+
+// 根据请求描述创建请求。
+func NewDownloadRequestFromSpec(id uint64,spec *RequestSpec,depth uint32) (*DownloadRequest,error){
+	httpReq,err:=spec.NewHttpRequest()
+	if err!=nil {
+		return nil,err
+	}
+	return &DownloadRequest{id:id,httpRequest:httpReq,depth:depth,spec:spec},nil
+}
+
+// 获得可序列化的请求描述，调用方不应修改其内容。
+func (req *DownloadRequest)Spec() *RequestSpec{
+	return req.spec
 }
 
 func (req *DownloadRequest)HttpReq() *http.Request{
@@ -33,16 +66,135 @@ func (req *DownloadRequest)GetID() uint64{
 	return req.id
 }
 
+// 将上下文附加到HTTP请求上，取消上下文会中止该请求。
+func (req *DownloadRequest)SetContext(ctx context.Context){
+	if req.httpRequest!=nil && ctx!=nil {
+		req.httpRequest=req.httpRequest.WithContext(ctx)
+	}
+}
+
+// 获得已经尝试下载的次数。
+func (req *DownloadRequest)Attempt() uint32{
+	return req.attempt
+}
+
+// 获得请求最早可以被发送的时间，零值表示不限制。
+func (req *DownloadRequest)NotBefore() time.Time{
+	return req.notBefore
+}
+
+// 复制请求并替换其中的HTTP请求，请求描述随之记录新HTTP请求的方法、URL、请求头与请求体。
+func (req *DownloadRequest)WithHttpReq(httpReq *http.Request) *DownloadRequest{
+	clone:=req.clone()
+	clone.httpRequest=httpReq
+	if httpReq!=nil && req.spec!=nil {
+		clone.spec=req.spec.withHttpReq(httpReq)
+	}
+	return clone
+}
+
+// 创建用于重试的请求，尝试次数加一，并在notBefore之前不会被发送。
+// 新请求的HTTP请求由请求描述重新创建，带有完整的请求体；
+// 请求描述先按当前的HTTP请求更新，因此中间件对请求头等的修改得以保留。
+func (req *DownloadRequest)NextAttempt(notBefore time.Time) *DownloadRequest{
+	next:=req.clone()
+	next.attempt=req.attempt+1
+	next.notBefore=notBefore
+	if req.spec!=nil {
+		if req.httpRequest!=nil {
+			next.spec=req.spec.withHttpReq(req.httpRequest)
+		}
+		if httpReq,err:=next.spec.NewHttpRequest();err==nil {
+			if req.httpRequest!=nil {
+				httpReq=httpReq.WithContext(req.httpRequest.Context())
+			}
+			next.httpRequest=httpReq
+		}
+	}
+	return next
+}
+
+// 复制请求，副本有独立的请求描述，修改其附加信息不会影响原请求。
+func (req *DownloadRequest)clone() *DownloadRequest{
+	clone:=*req
+	if req.spec!=nil {
+		clone.spec=req.spec.Clone()
+	}
+	return &clone
+}
+
+// 获得到达该URL已经过的重定向次数，只有加入请求缓存的重定向目标不为0。
+func (req *DownloadRequest)Redirects() int{
+	return req.redirects
+}
+
+// 设置到达该URL已经过的重定向次数，由调度器在将重定向的目标加入请求缓存时累加。
+func (req *DownloadRequest)SetRedirects(redirects int){
+	req.redirects=redirects
+}
+
+// 复制请求并设置深度。
+func (req *DownloadRequest)WithDepth(depth uint32) *DownloadRequest{
+	clone:=req.clone()
+	clone.depth=depth
+	return clone
+}
+
+// 获得优先级得分。
+func (req *DownloadRequest)Score() float64{
+	return req.score
+}
+
+// 获得父页面请求的得分。
+func (req *DownloadRequest)ParentScore() float64{
+	return req.parentScore
+}
+
+// 设置父页面请求的得分。
+func (req *DownloadRequest)SetParentScore(score float64){
+	req.parentScore=score
+}
+
 type DownloadRespond struct {
 	id uint64
 	httpResponse *http.Response
 	depth uint32
+	score float64 // 对应请求的得分。
+	body []byte // 已读取并解码的响应体。
+	truncated bool // 响应体是否因超过大小限制而被截断。
+	text []byte // 转换为UTF-8的文本，非文本响应为nil。
+	encoding string // 检测到的原始字符编码。
+	notModified bool // 是否为服务器返回304后以缓存代替的响应。
+	timing NetworkTiming // 下载的网络耗时。
+	redirects []Redirect // 到达最终URL之前经过的重定向。
+}
+
+// 重定向链中的一跳。
+type Redirect struct {
+	URL        *url.URL // 返回重定向的URL。
+	StatusCode int      // 重定向的状态码，如301、302。
+}
+
+// 一次下载的网络耗时，发生重定向时DNS、连接与TLS握手为各次请求之和。
+// 复用连接时DNS、连接与TLS握手的耗时为0。
+type NetworkTiming struct {
+	DNS          time.Duration // 域名解析。
+	Connect      time.Duration // 建立TCP连接。
+	TLSHandshake time.Duration // TLS握手。
+	FirstByte    time.Duration // 从开始请求到收到响应的第一个字节。
+	Total        time.Duration // 从开始请求到读取完响应体。
+	ConnReused   bool          // 最后一次请求是否复用了连接。
 }
 
 func NewDownloadResponse(id uint64, httpResponse *http.Response,depth uint32) *DownloadRespond{
 	return &DownloadRespond{id:id,httpResponse:httpResponse,depth:depth}
 }
 
+// 根据请求创建响应，继承请求的ID、深度与得分。
+func NewDownloadResponseFor(req *DownloadRequest, httpResponse *http.Response) *DownloadRespond{
+	return &DownloadRespond{id:req.id,httpResponse:httpResponse,depth:req.depth,score:req.score}
+}
+
 
 func (resp *DownloadRespond)HttpResp() *http.Response{
 	return resp.httpResponse
@@ -56,11 +208,114 @@ func (resp *DownloadRespond)GetID() uint64{
 	return resp.id
 }
 
+// 获得对应请求的得分。
+func (resp *DownloadRespond)Score() float64{
+	return resp.score
+}
+
+// 设置已读取的响应体，HTTP响应的Body随之替换为读取该响应体的读取器。
+func (resp *DownloadRespond)SetBody(body []byte,truncated bool){
+	resp.body=body
+	resp.truncated=truncated
+	if resp.httpResponse!=nil {
+		resp.httpResponse.Body=ioutil.NopCloser(bytes.NewReader(body))
+	}
+}
+
+// 获得已读取并解码的响应体，调用方不应修改其内容。
+func (resp *DownloadRespond)Body() []byte{
+	return resp.body
+}
+
+// 获得读取响应体的新读取器。
+func (resp *DownloadRespond)BodyReader() io.Reader{
+	return bytes.NewReader(resp.body)
+}
+
+// 响应体是否因超过大小限制而被截断。
+func (resp *DownloadRespond)Truncated() bool{
+	return resp.truncated
+}
+
+// 设置转换为UTF-8的文本及检测到的原始字符编码。
+func (resp *DownloadRespond)SetText(text []byte,encoding string){
+	resp.text=text
+	resp.encoding=encoding
+}
+
+// 获得转换为UTF-8的文本，非文本响应返回原始响应体。
+func (resp *DownloadRespond)Text() string{
+	if resp.text==nil {
+		return string(resp.body)
+	}
+	return string(resp.text)
+}
+
+// 获得读取UTF-8文本的新读取器，非文本响应读取原始响应体。
+func (resp *DownloadRespond)TextReader() io.Reader{
+	if resp.text==nil {
+		return bytes.NewReader(resp.body)
+	}
+	return bytes.NewReader(resp.text)
+}
+
+// 获得检测到的原始字符编码，如"utf-8"、"gbk"、"big5"，非文本响应为空。
+func (resp *DownloadRespond)Encoding() string{
+	return resp.encoding
+}
+
+// 设置响应是否为以缓存代替的未修改响应。
+func (resp *DownloadRespond)SetNotModified(notModified bool){
+	resp.notModified=notModified
+}
+
+// 是否为服务器返回304（未修改）后以缓存代替的响应。
+func (resp *DownloadRespond)NotModified() bool{
+	return resp.notModified
+}
+
+// 设置下载的网络耗时。
+func (resp *DownloadRespond)SetTiming(timing NetworkTiming){
+	resp.timing=timing
+}
+
+// 获得下载的网络耗时，从HTTP缓存或存档中读取的响应为零值。
+func (resp *DownloadRespond)Timing() NetworkTiming{
+	return resp.timing
+}
+
+// 设置到达最终URL之前经过的重定向。
+func (resp *DownloadRespond)SetRedirects(redirects []Redirect){
+	resp.redirects=redirects
+}
+
+// 获得到达最终URL之前经过的重定向，按先后顺序排列，未发生重定向时为空。
+// 最终URL为HttpResp().Request.URL。
+func (resp *DownloadRespond)Redirects() []Redirect{
+	return resp.redirects
+}
+
+// 复制响应，副本的HTTP响应带有从头读取UTF-8文本的新Body，
+// 使多个分析函数可以各自读取并关闭Body。
+func (resp *DownloadRespond)Clone() *DownloadRespond{
+	clone:=*resp
+	if resp.httpResponse!=nil {
+		httpResp:=*resp.httpResponse
+		httpResp.Body=ioutil.NopCloser(resp.TextReader())
+		clone.httpResponse=&httpResp
+	}
+	return &clone
+}
+
 
 
 // 条目。
 type ItemMap map[string]interface{}
 
+// 条目中标记页面未修改的键，对应的值为true时表示产生该条目的页面自上次爬取后未修改，
+// 条目处理器可以据此跳过未修改的页面。
+const ITEM_NOT_MODIFIED_KEY = "_notModified"
+
 // 数据是否有效。
 func (item ItemMap) IsValid() bool {
 	return item != nil
@@ -3,6 +3,11 @@ package basic
 import (
 	"errors"
 	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"time"
 )
 
 type Config interface {
@@ -118,3 +123,245 @@ func (config *PoolBaseConfig) PageDownloaderPoolSize() uint32 {
 func (config *PoolBaseConfig) PageParserPoolSize() uint32 {
 	return config.pageParserPoolSize
 }
+
+// 主机标识的方式。
+type HostKeyMode int
+
+// 主机标识方式常量。
+const (
+	HOST_KEY_PRIMARY_DOMAIN HostKeyMode = iota // 按主域名区分主机。
+	HOST_KEY_EXACT_HOST                        // 按完整的主机名区分主机。
+)
+
+var hostKeyModeNames = map[HostKeyMode]string{
+	HOST_KEY_PRIMARY_DOMAIN: "primary domain",
+	HOST_KEY_EXACT_HOST:     "exact host",
+}
+
+// 单个主机的礼貌爬取限制。
+type HostLimit struct {
+	Delay       time.Duration // 两次请求之间的最小间隔。
+	MaxInFlight uint32        // 同时进行的最大请求数，0表示不限制。
+}
+
+// 礼貌爬取参数容器的描述模板。
+var politenessConfigTemplate = "{ hostKey: %s, delay: %s, maxInFlight: %d," +
+	" hostLimits: %d, maxBuffered: %d }"
+
+// 默认从请求缓存预取的最大请求数，只计当前可以发送的主机的请求。
+const defaultMaxBuffered = 100
+
+// 礼貌爬取参数的容器。
+type PolitenessConfig struct {
+	hostKeyMode  HostKeyMode          // 主机标识的方式。
+	defaultLimit HostLimit            // 默认的主机限制。
+	hostLimits   map[string]HostLimit // 按主机标识单独设置的限制。
+	maxBuffered  uint32               // 调度器为当前可以发送的主机从请求缓存预取的最大请求数。
+	summary      string               // 描述。
+}
+
+func NewPolitenessConfig(hostKeyMode HostKeyMode, delay time.Duration, maxInFlight uint32) PolitenessConfig {
+	return PolitenessConfig{
+		hostKeyMode:  hostKeyMode,
+		defaultLimit: HostLimit{Delay: delay, MaxInFlight: maxInFlight},
+		hostLimits:   make(map[string]HostLimit),
+		maxBuffered:  defaultMaxBuffered,
+	}
+}
+
+// 为某个主机标识（主域名或完整主机名，取决于主机标识的方式）单独设置限制。
+func (config *PolitenessConfig) SetHostLimit(hostKey string, limit HostLimit) {
+	if config.hostLimits == nil {
+		config.hostLimits = make(map[string]HostLimit)
+	}
+	config.hostLimits[strings.ToLower(hostKey)] = limit
+	config.summary = ""
+}
+
+// 设置调度器从请求缓存预取的最大请求数，预取的请求越多，轮询时可选的主机越多。
+// 受最小间隔或最大并发数限制的主机的请求不计在内。
+func (config *PolitenessConfig) SetMaxBuffered(maxBuffered uint32) {
+	config.maxBuffered = maxBuffered
+	config.summary = ""
+}
+
+func (config *PolitenessConfig) IsValid() error {
+	if _, ok := hostKeyModeNames[config.hostKeyMode]; !ok {
+		return errors.New("The host key mode is unknown!\n")
+	}
+	if config.defaultLimit.Delay < 0 {
+		return errors.New("The politeness delay can not be negative!\n")
+	}
+	for host, limit := range config.hostLimits {
+		if limit.Delay < 0 {
+			return fmt.Errorf("The politeness delay of host %s can not be negative!\n", host)
+		}
+	}
+	if config.maxBuffered == 0 {
+		return errors.New("The politeness max buffered requests can not be 0!\n")
+	}
+	return nil
+}
+
+func (config *PolitenessConfig) Summary() string {
+	if config.summary == "" {
+		config.summary =
+			fmt.Sprintf(politenessConfigTemplate,
+				hostKeyModeNames[config.hostKeyMode],
+				config.defaultLimit.Delay,
+				config.defaultLimit.MaxInFlight,
+				len(config.hostLimits),
+				config.maxBuffered)
+	}
+	return config.summary
+}
+
+// 获得主机标识的方式。
+func (config *PolitenessConfig) HostKeyMode() HostKeyMode {
+	return config.hostKeyMode
+}
+
+// 获得主机的限制，未单独设置时返回默认限制。
+func (config *PolitenessConfig) HostLimit(hostKey string) HostLimit {
+	if limit, ok := config.hostLimits[hostKey]; ok {
+		return limit
+	}
+	return config.defaultLimit
+}
+
+// 获得从请求缓存预取的最大请求数。
+func (config *PolitenessConfig) MaxBuffered() uint32 {
+	return config.maxBuffered
+}
+
+// 响应体超过大小上限时的处理方式。
+type OversizeAction int
+
+// 超限处理方式常量。
+const (
+	OVERSIZE_TRUNCATE OversizeAction = iota // 截断响应体，响应仍交给分析器。
+	OVERSIZE_REJECT                         // 拒绝响应，返回错误。
+)
+
+var oversizeActionNames = map[OversizeAction]string{
+	OVERSIZE_TRUNCATE: "truncate",
+	OVERSIZE_REJECT:   "reject",
+}
+
+// 默认的响应体大小上限。
+const DefaultMaxBodySize = 10 << 20
+
+// 默认需要先以HEAD请求探测的扩展名，这类URL通常指向体积较大的非网页文件。
+var DefaultProbeExtensions = []string{
+	".iso", ".img", ".dmg", ".exe", ".msi", ".apk",
+	".zip", ".rar", ".7z", ".tar", ".gz", ".bz2", ".xz",
+	".mp4", ".avi", ".mkv", ".mov", ".wmv", ".flv", ".mp3", ".wav",
+	".pdf", ".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx",
+}
+
+// 下载限制参数容器的描述模板。
+var downloadLimitConfigTemplate = "{ maxBodySize: %d, oversize: %s," +
+	" allowedContentTypes: %v, probeExtensions: %d }"
+
+// 下载限制参数的容器。
+type DownloadLimitConfig struct {
+	maxBodySize         int64               // 响应体的大小上限（字节）。
+	oversizeAction      OversizeAction      // 超过大小上限时的处理方式。
+	allowedContentTypes []string            // 允许的内容类型，为空时不限制。
+	probeExtensions     map[string]struct{} // 需要先以HEAD请求探测的扩展名。
+	summary             string              // 描述。
+}
+
+// 创建下载限制参数。allowedContentTypes为允许的内容类型（如"text/html"），
+// 以'/'结尾的类型按前缀匹配（如"text/"），为空时不限制。
+func NewDownloadLimitConfig(maxBodySize int64,
+	oversizeAction OversizeAction,
+	allowedContentTypes ...string) DownloadLimitConfig {
+	types := make([]string, 0, len(allowedContentTypes))
+	for _, contentType := range allowedContentTypes {
+		if contentType = strings.ToLower(strings.TrimSpace(contentType)); contentType != "" {
+			types = append(types, contentType)
+		}
+	}
+	return DownloadLimitConfig{
+		maxBodySize:         maxBodySize,
+		oversizeAction:      oversizeAction,
+		allowedContentTypes: types,
+		probeExtensions:     make(map[string]struct{}),
+	}
+}
+
+// 设置需要先以HEAD请求探测大小与内容类型的URL扩展名，例如DefaultProbeExtensions。
+func (config *DownloadLimitConfig) SetProbeExtensions(extensions ...string) {
+	config.probeExtensions = make(map[string]struct{}, len(extensions))
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		config.probeExtensions[ext] = struct{}{}
+	}
+	config.summary = ""
+}
+
+func (config *DownloadLimitConfig) IsValid() error {
+	if config.maxBodySize <= 0 {
+		return errors.New("The max body size must be greater than 0!\n")
+	}
+	if _, ok := oversizeActionNames[config.oversizeAction]; !ok {
+		return errors.New("The oversize action is unknown!\n")
+	}
+	return nil
+}
+
+func (config *DownloadLimitConfig) Summary() string {
+	if config.summary == "" {
+		config.summary =
+			fmt.Sprintf(downloadLimitConfigTemplate,
+				config.maxBodySize,
+				oversizeActionNames[config.oversizeAction],
+				config.allowedContentTypes,
+				len(config.probeExtensions))
+	}
+	return config.summary
+}
+
+// 获得响应体的大小上限。
+func (config *DownloadLimitConfig) MaxBodySize() int64 {
+	return config.maxBodySize
+}
+
+// 获得超过大小上限时的处理方式。
+func (config *DownloadLimitConfig) OversizeAction() OversizeAction {
+	return config.oversizeAction
+}
+
+// 判断内容类型是否允许，内容类型为空时允许。
+func (config *DownloadLimitConfig) AllowContentType(contentType string) bool {
+	if len(config.allowedContentTypes) == 0 || strings.TrimSpace(contentType) == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	for _, allowed := range config.allowedContentTypes {
+		if mediaType == allowed ||
+			(strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断URL是否需要先以HEAD请求探测。
+func (config *DownloadLimitConfig) ShouldProbe(u *url.URL) bool {
+	if u == nil || len(config.probeExtensions) == 0 {
+		return false
+	}
+	_, ok := config.probeExtensions[strings.ToLower(path.Ext(u.Path))]
+	return ok
+}
@@ -0,0 +1,361 @@
+package basic
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 日志记录的操作类型。
+const (
+	cacheOpPut  = "put"
+	cacheOpDone = "done"
+)
+
+// 触发压缩的最小日志记录数。
+const compactMinRecords = 1024
+
+// 磁盘缓存日志中单行记录的最大长度。
+const maxCacheRecordSize = 1 << 20
+
+// 持久化的请求。
+type requestRecord struct {
+	ID     uint64      `json:"id"`
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Depth  uint32      `json:"depth"`
+	// 父页面请求的得分，重新打开时据此重新计算得分。
+	ParentScore float64 `json:"parentScore,omitempty"`
+	// 重试的请求已经尝试下载的次数与最早发送时间（Unix纳秒）。
+	Attempt   uint32 `json:"attempt,omitempty"`
+	NotBefore int64  `json:"notBefore,omitempty"`
+	// 请求体与附加信息，使POST等带有请求体的请求同样可以恢复。
+	Body []byte            `json:"body,omitempty"`
+	Meta map[string]string `json:"meta,omitempty"`
+	// 加入请求缓存的重定向目标已经过的重定向次数。
+	Redirects int `json:"redirects,omitempty"`
+}
+
+// 缓存日志中的一条记录。
+type cacheRecord struct {
+	Op  string         `json:"op"`
+	Seq uint64         `json:"seq"`
+	Req *requestRecord `json:"req,omitempty"`
+}
+
+// 基于磁盘的请求缓存。
+// 所有Put与Done操作都会追加写入日志文件，重新打开时通过回放日志恢复未完成的请求。
+// 已被Get取出但尚未Done的请求同样会被恢复，保证崩溃后不丢失正在下载的请求。
+type diskRequestCache struct {
+	sync.Mutex
+	path     string                      // 日志文件路径。
+	file     *os.File                    // 日志文件。
+	queue    *requestQueue               // 待取出的请求。
+	pending  map[uint64]*DownloadRequest // 尚未完成的请求，包括已取出的请求。
+	inFlight map[*DownloadRequest]uint64 // 已取出但尚未完成的请求。
+	nextSeq  uint64                      // 下一个序号。
+	records  int                         // 日志文件中的记录数。
+	status   CacheStatus
+}
+
+// 创建基于磁盘的请求缓存，如果日志文件已存在则恢复其中未完成的请求。
+// 请求按评分函数排序，评分函数为nil时先进先出。
+func NewDiskRequestCache(path string, score ScoreFunc) (RequestCache, error) {
+	if path == "" {
+		return nil, errors.New("The request cache path can not be empty.")
+	}
+	rc := &diskRequestCache{
+		path:     path,
+		queue:    newRequestQueue(0, score),
+		pending:  make(map[uint64]*DownloadRequest),
+		inFlight: make(map[*DownloadRequest]uint64),
+	}
+	if err := rc.load(); err != nil {
+		return nil, err
+	}
+	if err := rc.compact(); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// 回放日志文件。
+func (rc *diskRequestCache) load() error {
+	file, err := os.Open(rc.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxCacheRecordSize)
+	for scanner.Scan() {
+		var record cacheRecord
+		// 崩溃时可能写入了不完整的记录，直接忽略。
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if record.Seq >= rc.nextSeq {
+			rc.nextSeq = record.Seq + 1
+		}
+		switch record.Op {
+		case cacheOpPut:
+			req, err := record.Req.toRequest()
+			if err != nil {
+				continue
+			}
+			rc.pending[record.Seq] = req
+		case cacheOpDone:
+			delete(rc.pending, record.Seq)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, seq := range rc.pendingSeqs() {
+		rc.queue.push(seq, rc.pending[seq])
+	}
+	return nil
+}
+
+// 按序号排序的未完成请求。
+func (rc *diskRequestCache) pendingSeqs() []uint64 {
+	seqs := make([]uint64, 0, len(rc.pending))
+	for seq := range rc.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+// 以未完成的请求重写日志文件。调用方需持有锁或保证没有并发访问。
+func (rc *diskRequestCache) compact() error {
+	if rc.file != nil {
+		rc.file.Close()
+		rc.file = nil
+	}
+	seqs := rc.pendingSeqs()
+	tmpPath := rc.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, seq := range seqs {
+		line, err := json.Marshal(cacheRecord{Op: cacheOpPut, Seq: seq, Req: newRequestRecord(rc.pending[seq])})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, rc.path); err != nil {
+		return err
+	}
+	rc.records = len(seqs)
+	rc.file, err = os.OpenFile(rc.path, os.O_WRONLY|os.O_APPEND, 0644)
+	return err
+}
+
+// 追加一条日志记录，必要时压缩日志。调用方需持有锁。
+func (rc *diskRequestCache) appendRecord(record cacheRecord) error {
+	if rc.file == nil {
+		return errors.New("The request cache log is not open.")
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := rc.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	rc.records++
+	if rc.records >= compactMinRecords && rc.records > 2*len(rc.pending) {
+		return rc.compact()
+	}
+	return nil
+}
+
+func (rc *diskRequestCache) Put(req *DownloadRequest) error {
+	if req == nil {
+		return errors.New("The request can not be nil.")
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	if rc.status == STATUS_CLOSED {
+		return errors.New("The cache has been closed.")
+	}
+	seq := rc.nextSeq
+	if err := rc.appendRecord(cacheRecord{Op: cacheOpPut, Seq: seq, Req: newRequestRecord(req)}); err != nil {
+		return err
+	}
+	rc.nextSeq++
+	rc.pending[seq] = req
+	rc.queue.push(seq, req)
+	return nil
+}
+
+func (rc *diskRequestCache) Get() *DownloadRequest {
+	rc.Lock()
+	defer rc.Unlock()
+	if rc.status == STATUS_CLOSED {
+		return nil
+	}
+	entry := rc.queue.pop()
+	if entry == nil {
+		return nil
+	}
+	rc.inFlight[entry.req] = entry.seq
+	return entry.req
+}
+
+func (rc *diskRequestCache) Done(req *DownloadRequest) {
+	rc.Lock()
+	defer rc.Unlock()
+	// 关闭后无法记录完成状态，请求保持未完成，重新打开时会再次入队。
+	if rc.status == STATUS_CLOSED {
+		return
+	}
+	seq, ok := rc.inFlight[req]
+	if !ok {
+		return
+	}
+	delete(rc.inFlight, req)
+	delete(rc.pending, seq)
+	rc.appendRecord(cacheRecord{Op: cacheOpDone, Seq: seq})
+}
+
+func (rc *diskRequestCache) Length() int {
+	rc.Lock()
+	defer rc.Unlock()
+	return rc.queue.Len()
+}
+
+func (rc *diskRequestCache) Capacity() int {
+	rc.Lock()
+	defer rc.Unlock()
+	return rc.queue.capacity()
+}
+
+// 关闭缓存，已取出但尚未完成的请求会保留在日志中。
+func (rc *diskRequestCache) Close() {
+	rc.Lock()
+	defer rc.Unlock()
+	if rc.status == STATUS_CLOSED {
+		return
+	}
+	rc.status = STATUS_CLOSED
+	if rc.file != nil {
+		rc.file.Sync()
+		rc.file.Close()
+		rc.file = nil
+	}
+}
+
+// 重新打开缓存并压缩日志，压缩失败时返回错误，缓存保持关闭，Put会返回错误而不是丢失请求。
+func (rc *diskRequestCache) Open() error {
+	rc.Lock()
+	defer rc.Unlock()
+	if rc.status != STATUS_CLOSED {
+		rc.status = STATUS_RUNNING
+		return nil
+	}
+	// 重新打开时，已取出但未完成的请求重新入队。
+	for req, seq := range rc.inFlight {
+		rc.queue.push(seq, req)
+		delete(rc.inFlight, req)
+	}
+	if err := rc.compact(); err != nil {
+		return fmt.Errorf("Reopen the request cache %s error: %s", rc.path, err)
+	}
+	rc.status = STATUS_RUNNING
+	return nil
+}
+
+// 磁盘缓存摘要信息模板。
+var diskSummaryTemplate = summaryTemplate + ", in-flight: %d, log records: %d, path: %s"
+
+func (rc *diskRequestCache) Summary() string {
+	rc.Lock()
+	defer rc.Unlock()
+	return fmt.Sprintf(diskSummaryTemplate,
+		statusMsg[rc.status],
+		rc.queue.Len(),
+		rc.queue.capacity(),
+		len(rc.inFlight),
+		rc.records,
+		rc.path)
+}
+
+func newRequestRecord(req *DownloadRequest) *requestRecord {
+	httpReq := req.HttpReq()
+	record := &requestRecord{
+		ID:          req.GetID(),
+		Depth:       req.Depth(),
+		ParentScore: req.ParentScore(),
+		Attempt:     req.Attempt(),
+		Redirects:   req.Redirects(),
+	}
+	if !req.NotBefore().IsZero() {
+		record.NotBefore = req.NotBefore().UnixNano()
+	}
+	if spec := req.Spec(); spec != nil {
+		record.Method = spec.Method
+		record.URL = spec.URL
+		record.Header = spec.Header
+		record.Body = spec.Body
+		record.Meta = spec.Meta
+	} else if httpReq != nil {
+		record.Method = httpReq.Method
+		record.Header = httpReq.Header
+		if httpReq.URL != nil {
+			record.URL = httpReq.URL.String()
+		}
+	}
+	return record
+}
+
+func (record *requestRecord) toRequest() (*DownloadRequest, error) {
+	if record == nil {
+		return nil, errors.New("The request record is nil.")
+	}
+	spec := &RequestSpec{
+		Method: record.Method,
+		URL:    record.URL,
+		Header: record.Header,
+		Body:   record.Body,
+		Meta:   record.Meta,
+	}
+	req, err := NewDownloadRequestFromSpec(record.ID, spec, record.Depth)
+	if err != nil {
+		return nil, err
+	}
+	req.SetParentScore(record.ParentScore)
+	req.attempt = record.Attempt
+	req.redirects = record.Redirects
+	if record.NotBefore != 0 {
+		req.notBefore = time.Unix(0, record.NotBefore)
+	}
+	return req, nil
+}
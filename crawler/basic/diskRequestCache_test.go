@@ -0,0 +1,125 @@
+package basic
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestRequest(t *testing.T, url string) *DownloadRequest {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDownloadRequest(0, req, 1)
+}
+
+func TestDiskRequestCacheReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawlergo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "requests.log")
+
+	cache, err := NewDiskRequestCache(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, url := range []string{"http://a.com/1", "http://a.com/2", "http://a.com/3"} {
+		req := newTestRequest(t, url)
+		req.SetRedirects(i)
+		if err := cache.Put(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache.Done(cache.Get())
+	// 取出但未完成的请求在重新打开后应当恢复。
+	cache.Get()
+	cache.Close()
+
+	cache, err = NewDiskRequestCache(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Length() != 2 {
+		t.Fatalf("The cache length is %d, expected 2.", cache.Length())
+	}
+	for i, expected := range []string{"http://a.com/2", "http://a.com/3"} {
+		req := cache.Get()
+		if req == nil || req.HttpReq().URL.String() != expected || req.Redirects() != i+1 {
+			t.Fatalf("Get %v, expected %s.", req, expected)
+		}
+		cache.Done(req)
+	}
+	cache.Close()
+}
+
+func TestDiskRequestCacheCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawlergo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "requests.log")
+
+	cache, err := NewDiskRequestCache(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < compactMinRecords; i++ {
+		cache.Put(newTestRequest(t, "http://a.com/"))
+		cache.Done(cache.Get())
+	}
+	cache.Put(newTestRequest(t, "http://a.com/last"))
+	impl := cache.(*diskRequestCache)
+	if impl.records > compactMinRecords {
+		t.Errorf("The log has %d records, it should have been compacted.", impl.records)
+	}
+	cache.Close()
+
+	cache, err = NewDiskRequestCache(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req := cache.Get(); req == nil || req.HttpReq().URL.Path != "/last" {
+		t.Errorf("Get %v after compaction, expected /last.", req)
+	}
+}
+
+func TestDiskRequestCacheReopenError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawlergo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "requests.log")
+	cache, err := NewDiskRequestCache(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put(newTestRequest(t, "http://a.com/1")); err != nil {
+		t.Fatal(err)
+	}
+	cache.Close()
+	// 临时文件的路径被目录占用，压缩日志失败。
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Open(); err == nil {
+		t.Fatal("Reopen should report the compact error.")
+	}
+	if err := cache.Put(newTestRequest(t, "http://a.com/2")); err == nil {
+		t.Fatal("The cache failed to reopen should stay closed.")
+	}
+	os.Remove(path + ".tmp")
+	if err := cache.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Length() != 1 {
+		t.Fatalf("Length %d after reopen, expected 1.", cache.Length())
+	}
+	cache.Close()
+}
@@ -13,6 +13,19 @@ const (
 	DOWNLOADER_ERROR     ErrorType = "Downloader Error"
 	PAGEPARSER_ERROR     ErrorType = "PageParser Error"
 	ITEM_PROCESSOR_ERROR ErrorType = "Item Processor Error"
+	ROBOTS_ERROR         ErrorType = "Robots Error"
+	// 请求未能放入请求缓存，如持久化的爬取边界写入失败。
+	FRONTIER_ERROR ErrorType = "Frontier Error"
+	// 响应体超过大小上限而被拒绝。
+	RESPONSE_TOO_LARGE_ERROR ErrorType = "Response Too Large Error"
+	// 响应的内容类型不在允许的列表中。
+	CONTENT_TYPE_ERROR ErrorType = "Content Type Error"
+	// 请求的URL协议不被支持。
+	SCHEME_ERROR ErrorType = "Scheme Error"
+	// 回放时请求的URL不在存档中。
+	ARCHIVE_MISS_ERROR ErrorType = "Archive Miss Error"
+	// 重定向超出许可范围或次数限制。
+	REDIRECT_ERROR ErrorType = "Redirect Error"
 )
 
 // 爬虫错误的接口。
@@ -23,62 +23,86 @@ var statusMsg = map[CacheStatus]string{
 type RequestCache interface {
 	Put(req *DownloadRequest) error
 	Get() *DownloadRequest
+	Done(req *DownloadRequest) // 告知缓存该请求已处理完毕（无论成功与否）。
 	Capacity() int
 	Length() int
 	Close()
-	Open ()
+	Open() error // 重新打开关闭的缓存，失败时缓存保持关闭。
 	Summary() string
 }
 
 type requestCacheImpl struct {
 	sync.Mutex
-	cache  []*DownloadRequest
+	cache  *requestQueue
+	seq    uint64
 	status CacheStatus
 }
 
+// 创建先进先出的请求缓存。
 func NewRequestCache(capacity uint) RequestCache {
-	return &requestCacheImpl{cache: make([]*DownloadRequest, capacity)}
+	return NewPriorityRequestCache(capacity, nil)
+}
+
+// 创建按评分函数排序的请求缓存，评分函数为nil时先进先出。
+func NewPriorityRequestCache(capacity uint, score ScoreFunc) RequestCache {
+	return &requestCacheImpl{cache: newRequestQueue(capacity, score)}
 }
 
 func (rci *requestCacheImpl) Put(req *DownloadRequest) error {
 	if req==nil {
 		return errors.New("The request can not be nil.")
 	}
+	rci.Lock()
+	defer rci.Unlock()
 	if rci.status==STATUS_CLOSED{
 		return errors.New("The cache has been closed.")
 	}
-	rci.Lock()
-	defer rci.Unlock()
-	rci.cache=append(rci.cache,req)
+	rci.cache.push(rci.seq,req)
+	rci.seq++
 	return nil
 }
 
 func (rci *requestCacheImpl) Get( ) *DownloadRequest {
-	if rci.status==STATUS_CLOSED || rci.Length()==0 {
-		return nil
-	}
 	rci.Lock()
 	defer rci.Unlock()
-	req:=rci.cache[0]
-	rci.cache=rci.cache[1:]
-	return req
+	if rci.status==STATUS_CLOSED || rci.cache.Len()==0 {
+		return nil
+	}
+	entry:=rci.cache.pop()
+	if entry==nil {
+		return nil
+	}
+	return entry.req
+}
+
+// 内存缓存在Get时即已移除请求，无需额外处理。
+func (rci *requestCacheImpl) Done(req *DownloadRequest) {
 }
 
 func (rci *requestCacheImpl) Length() int{
-	return len(rci.cache)
+	rci.Lock()
+	defer rci.Unlock()
+	return rci.cache.Len()
 }
 
 func (rci *requestCacheImpl) Capacity() int {
-	return cap(rci.cache)
+	rci.Lock()
+	defer rci.Unlock()
+	return rci.cache.capacity()
 }
 
 
 func (rci *requestCacheImpl) Close() {
+	rci.Lock()
+	defer rci.Unlock()
 	rci.status=STATUS_CLOSED
 }
 
-func (rci *requestCacheImpl) Open() {
+func (rci *requestCacheImpl) Open() error {
+	rci.Lock()
+	defer rci.Unlock()
 	rci.status=STATUS_RUNNING
+	return nil
 }
 
 
@@ -86,9 +110,11 @@ func (rci *requestCacheImpl) Open() {
 var summaryTemplate = "status: %s, " + "length: %d, " + "capacity: %d"
 
 func (rci *requestCacheImpl) Summary() string {
+	rci.Lock()
+	defer rci.Unlock()
 	summary := fmt.Sprintf(summaryTemplate,
 		statusMsg[rci.status],
-		rci.Length(),
-		rci.Capacity())
+		rci.cache.Len(),
+		rci.cache.capacity())
 	return summary
 }
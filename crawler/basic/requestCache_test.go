@@ -0,0 +1,70 @@
+package basic
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func newScoredRequest(t *testing.T, url string, depth uint32) *DownloadRequest {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDownloadRequest(0, req, depth)
+}
+
+func checkOrder(t *testing.T, cache RequestCache, expected []string) {
+	for _, url := range expected {
+		req := cache.Get()
+		if req == nil || req.HttpReq().URL.String() != url {
+			t.Fatalf("Get %v, expected %s.", req, url)
+		}
+	}
+	if req := cache.Get(); req != nil {
+		t.Fatalf("Get %v from an empty cache.", req)
+	}
+}
+
+func TestRequestCacheStrategies(t *testing.T) {
+	urls := []string{"http://a.com/1", "http://a.com/2", "http://a.com/3"}
+	depths := []uint32{2, 1, 2}
+	cases := []struct {
+		name     string
+		strategy ScoreFunc
+		expected []string
+	}{
+		{"FIFO", nil, []string{"http://a.com/1", "http://a.com/2", "http://a.com/3"}},
+		{"BFS", BFSStrategy, []string{"http://a.com/2", "http://a.com/1", "http://a.com/3"}},
+		{"DFS", DFSStrategy, []string{"http://a.com/1", "http://a.com/3", "http://a.com/2"}},
+	}
+	for _, c := range cases {
+		cache := NewPriorityRequestCache(0, c.strategy)
+		for i, url := range urls {
+			cache.Put(newScoredRequest(t, url, depths[i]))
+		}
+		t.Log(c.name)
+		checkOrder(t, cache, c.expected)
+	}
+}
+
+func TestBestFirstStrategy(t *testing.T) {
+	strategy := BestFirstStrategy([]ScoreRule{
+		{Pattern: regexp.MustCompile(`/article/`), Score: 10},
+		{Pattern: regexp.MustCompile(`/tag/`), Score: -5},
+		{Domain: "b.com", Score: 1},
+	}, 1, 0.5)
+	cache := NewPriorityRequestCache(0, strategy)
+	cache.Put(newScoredRequest(t, "http://a.com/tag/go", 1))
+	cache.Put(newScoredRequest(t, "http://a.com/archive", 1))
+	child := newScoredRequest(t, "http://www.b.com/page", 2)
+	child.SetParentScore(8)
+	cache.Put(child)
+	cache.Put(newScoredRequest(t, "http://a.com/article/1", 3))
+	checkOrder(t, cache, []string{
+		"http://a.com/article/1",
+		"http://www.b.com/page",
+		"http://a.com/archive",
+		"http://a.com/tag/go",
+	})
+}
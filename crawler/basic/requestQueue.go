@@ -0,0 +1,104 @@
+package basic
+
+import (
+	"container/heap"
+)
+
+// 优先队列中的一个条目。
+type queueEntry struct {
+	seq   uint64           // 入队序号，得分相同时先入队者先出。
+	score float64          // 优先级得分，得分越高越先出队。
+	req   *DownloadRequest // 请求。
+}
+
+// 按得分排序的请求优先队列，得分相同时按入队顺序出队。
+// 不是并发安全的，由使用方加锁。
+type requestQueue struct {
+	entries []*queueEntry
+	score   ScoreFunc
+}
+
+func newRequestQueue(capacity uint, score ScoreFunc) *requestQueue {
+	return &requestQueue{entries: make([]*queueEntry, 0, capacity), score: score}
+}
+
+func (q *requestQueue) Len() int { return len(q.entries) }
+
+func (q *requestQueue) Less(i, j int) bool {
+	if q.entries[i].score != q.entries[j].score {
+		return q.entries[i].score > q.entries[j].score
+	}
+	return q.entries[i].seq < q.entries[j].seq
+}
+
+func (q *requestQueue) Swap(i, j int) { q.entries[i], q.entries[j] = q.entries[j], q.entries[i] }
+
+func (q *requestQueue) Push(x interface{}) { q.entries = append(q.entries, x.(*queueEntry)) }
+
+func (q *requestQueue) Pop() interface{} {
+	n := len(q.entries)
+	entry := q.entries[n-1]
+	q.entries[n-1] = nil
+	q.entries = q.entries[:n-1]
+	return entry
+}
+
+// 计算请求的得分并入队。
+func (q *requestQueue) push(seq uint64, req *DownloadRequest) *queueEntry {
+	if q.score != nil {
+		req.score = q.score(req)
+	}
+	entry := &queueEntry{seq: seq, score: req.score, req: req}
+	heap.Push(q, entry)
+	return entry
+}
+
+// 取出得分最高的请求，队列为空时返回nil。
+func (q *requestQueue) pop() *queueEntry {
+	if len(q.entries) == 0 {
+		return nil
+	}
+	return heap.Pop(q).(*queueEntry)
+}
+
+func (q *requestQueue) capacity() int {
+	return cap(q.entries)
+}
+
+// 按请求已有的得分排序的请求队列，得分相同时先入队者先出。
+// 调度器用它为各主机保持请求缓存中的顺序。不是并发安全的，由使用方加锁。
+type ScoredQueue struct {
+	queue *requestQueue
+	seq   uint64
+}
+
+func NewScoredQueue() *ScoredQueue {
+	return &ScoredQueue{queue: newRequestQueue(0, nil)}
+}
+
+// 按请求的得分入队，不重新计算得分。
+func (q *ScoredQueue) Push(req *DownloadRequest) {
+	q.queue.push(q.seq, req)
+	q.seq++
+}
+
+// 取出得分最高的请求，队列为空时返回nil。
+func (q *ScoredQueue) Pop() *DownloadRequest {
+	entry := q.queue.pop()
+	if entry == nil {
+		return nil
+	}
+	return entry.req
+}
+
+// 获得得分最高的请求但不取出，队列为空时返回nil。
+func (q *ScoredQueue) Peek() *DownloadRequest {
+	if q.queue.Len() == 0 {
+		return nil
+	}
+	return q.queue.entries[0].req
+}
+
+func (q *ScoredQueue) Len() int {
+	return q.queue.Len()
+}
@@ -0,0 +1,148 @@
+package basic
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 可序列化的请求描述，每次下载都由它重新创建HTTP请求，
+// 因此带有请求体的请求（如POST表单）同样可以重试、持久化与去重。
+type RequestSpec struct {
+	Method string            `json:"method"`
+	URL    string            `json:"url"`
+	Header http.Header       `json:"header,omitempty"`
+	Body   []byte            `json:"body,omitempty"`
+	Meta   map[string]string `json:"meta,omitempty"` // 附加信息，不会发送，可供分析函数使用。
+}
+
+// 创建请求描述，body为nil时没有请求体。
+func NewRequestSpec(method string, rawUrl string, body []byte) *RequestSpec {
+	return &RequestSpec{Method: method, URL: rawUrl, Header: http.Header{}, Body: body}
+}
+
+// 创建以application/x-www-form-urlencoded提交表单的POST请求描述。
+func NewFormRequestSpec(rawUrl string, form url.Values) *RequestSpec {
+	spec := NewRequestSpec(http.MethodPost, rawUrl, []byte(form.Encode()))
+	spec.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return spec
+}
+
+// 根据HTTP请求创建请求描述。请求体会被读出，原请求的Body随之替换为可重复读取的副本。
+func newRequestSpecFrom(httpReq *http.Request) *RequestSpec {
+	spec := &RequestSpec{Method: httpReq.Method, Header: httpReq.Header.Clone()}
+	if httpReq.URL != nil {
+		spec.URL = httpReq.URL.String()
+	}
+	if httpReq.GetBody != nil {
+		if body, err := httpReq.GetBody(); err == nil {
+			spec.Body, _ = ioutil.ReadAll(body)
+			body.Close()
+		}
+	} else if httpReq.Body != nil && httpReq.Body != http.NoBody {
+		spec.Body, _ = ioutil.ReadAll(httpReq.Body)
+		httpReq.Body.Close()
+		data := spec.Body
+		httpReq.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+		httpReq.Body, _ = httpReq.GetBody()
+	}
+	return spec
+}
+
+// 创建新的HTTP请求，每次调用都带有从头读取的请求体。
+func (spec *RequestSpec) NewHttpRequest() (*http.Request, error) {
+	var body io.Reader
+	if spec.Body != nil {
+		body = bytes.NewReader(spec.Body)
+	}
+	httpReq, err := http.NewRequest(spec.Method, spec.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Header != nil {
+		httpReq.Header = spec.Header.Clone()
+	}
+	return httpReq, nil
+}
+
+// 复制请求描述并替换URL。
+func (spec *RequestSpec) WithURL(rawUrl string) *RequestSpec {
+	clone := spec.Clone()
+	clone.URL = rawUrl
+	return clone
+}
+
+// 复制请求描述，副本的请求头、请求体与附加信息都不与原描述共享。
+func (spec *RequestSpec) Clone() *RequestSpec {
+	clone := *spec
+	clone.Header = spec.Header.Clone()
+	if spec.Body != nil {
+		clone.Body = append([]byte{}, spec.Body...)
+	}
+	if spec.Meta != nil {
+		clone.Meta = make(map[string]string, len(spec.Meta))
+		for key, value := range spec.Meta {
+			clone.Meta[key] = value
+		}
+	}
+	return &clone
+}
+
+// 复制请求描述，并以HTTP请求当前的方法、URL、请求头与请求体代替原有的内容，附加信息保持不变。
+// HTTP请求的请求体无法重复读取时保留原有的请求体。
+func (spec *RequestSpec) withHttpReq(httpReq *http.Request) *RequestSpec {
+	clone := spec.Clone()
+	clone.Method = httpReq.Method
+	if httpReq.URL != nil {
+		clone.URL = httpReq.URL.String()
+	}
+	clone.Header = httpReq.Header.Clone()
+	if httpReq.GetBody != nil {
+		if body, err := httpReq.GetBody(); err == nil {
+			clone.Body, _ = ioutil.ReadAll(body)
+			body.Close()
+		}
+	} else if httpReq.Body == nil || httpReq.Body == http.NoBody {
+		clone.Body = nil
+	}
+	return clone
+}
+
+// 获得附加信息。
+func (spec *RequestSpec) GetMeta(key string) string {
+	return spec.Meta[key]
+}
+
+// 设置附加信息。
+func (spec *RequestSpec) SetMeta(key string, value string) {
+	if spec.Meta == nil {
+		spec.Meta = map[string]string{}
+	}
+	spec.Meta[key] = value
+}
+
+// 获得用于去重的指纹。没有请求体的GET请求的指纹即为规范化后的URL，
+// 其他请求的指纹由请求方法、规范化后的URL与请求体的SHA1组成。
+// canonicalize为nil时使用原始的URL。
+func (spec *RequestSpec) Fingerprint(canonicalize func(u *url.URL) string) string {
+	key := spec.URL
+	if u, err := url.Parse(spec.URL); err == nil && canonicalize != nil {
+		key = canonicalize(u)
+	}
+	method := strings.ToUpper(spec.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if method == http.MethodGet && len(spec.Body) == 0 {
+		return key
+	}
+	sum := sha1.Sum(spec.Body)
+	return method + " " + key + " " + hex.EncodeToString(sum[:])
+}
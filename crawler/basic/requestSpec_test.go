@@ -0,0 +1,95 @@
+package basic
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestSpecFingerprint(t *testing.T) {
+	get := NewRequestSpec("GET", "http://a.com/search?q=1", nil)
+	if get.Fingerprint(nil) != "http://a.com/search?q=1" {
+		t.Errorf("The GET fingerprint should be the url: %s", get.Fingerprint(nil))
+	}
+	form1 := NewFormRequestSpec("http://a.com/search", url.Values{"q": {"1"}})
+	form2 := NewFormRequestSpec("http://a.com/search", url.Values{"q": {"2"}})
+	if form1.Fingerprint(nil) == form2.Fingerprint(nil) ||
+		form1.Fingerprint(nil) != NewFormRequestSpec("http://a.com/search", url.Values{"q": {"1"}}).Fingerprint(nil) {
+		t.Error("The POST fingerprint should depend on the body only.")
+	}
+}
+
+func TestRequestSpecRetryAndPersist(t *testing.T) {
+	// 由HTTP请求创建时，读出的请求体在每次尝试中都完整发送。
+	httpReq, _ := http.NewRequest("POST", "http://a.com/search", strings.NewReader("q=go"))
+	req := NewDownloadRequest(0, httpReq, 1)
+	req.Spec().SetMeta("page", "1")
+	for i := 0; i < 2; i++ {
+		body, _ := ioutil.ReadAll(req.HttpReq().Body)
+		if string(body) != "q=go" {
+			t.Fatalf("Attempt %d sends body %q.", i, body)
+		}
+		req = req.NextAttempt(time.Time{})
+	}
+
+	dir, err := ioutil.TempDir("", "crawlergo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "requests.log")
+	cache, err := NewDiskRequestCache(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Put(req)
+	cache.Close()
+	cache, err = NewDiskRequestCache(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	restored := cache.Get()
+	if restored == nil || restored.HttpReq().Method != "POST" || restored.Spec().GetMeta("page") != "1" {
+		t.Fatalf("Unexpected restored request: %v", restored)
+	}
+	body, _ := ioutil.ReadAll(restored.HttpReq().Body)
+	if string(body) != "q=go" || restored.Attempt() != 2 {
+		t.Fatalf("Unexpected restored body %q or attempt %d.", body, restored.Attempt())
+	}
+}
+
+func TestDownloadRequestClones(t *testing.T) {
+	httpReq, _ := http.NewRequest("POST", "http://a.com/search", strings.NewReader("q=go"))
+	req := NewDownloadRequest(0, httpReq, 1)
+	req.Spec().SetMeta("page", "1")
+	// 每个副本的请求描述互不影响。
+	clones := []*DownloadRequest{req.WithDepth(2), req.WithHttpReq(req.HttpReq()), req.NextAttempt(time.Time{})}
+	for i, clone := range clones {
+		clone.Spec().SetMeta("page", strconv.Itoa(i+2))
+	}
+	if req.Spec().GetMeta("page") != "1" || clones[0].Spec().GetMeta("page") != "2" {
+		t.Fatalf("The clones share the request spec: %s, %s", req.Spec().GetMeta("page"), clones[0].Spec().GetMeta("page"))
+	}
+
+	// 替换的HTTP请求与原地修改的请求头在重试时都得以保留。
+	replaced, _ := http.NewRequest("PUT", "http://a.com/edit", strings.NewReader("q=crawler"))
+	replaced.Header.Set("Authorization", "token")
+	next := req.WithHttpReq(replaced)
+	next.HttpReq().Header.Set("X-Trace", "1")
+	next = next.NextAttempt(time.Time{})
+	body, _ := ioutil.ReadAll(next.HttpReq().Body)
+	if next.HttpReq().Method != "PUT" || next.HttpReq().URL.Path != "/edit" || string(body) != "q=crawler" ||
+		next.HttpReq().Header.Get("Authorization") != "token" || next.HttpReq().Header.Get("X-Trace") != "1" {
+		t.Fatalf("Unexpected next attempt: %s %s %q %v", next.HttpReq().Method, next.HttpReq().URL, body, next.HttpReq().Header)
+	}
+	if next.Spec().GetMeta("page") != "1" || req.Spec().Method != "POST" || req.Spec().Header.Get("X-Trace") != "" {
+		t.Fatalf("Unexpected request specs: %+v, %+v", next.Spec(), req.Spec())
+	}
+}
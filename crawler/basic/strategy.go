@@ -0,0 +1,62 @@
+package basic
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 请求的评分函数，请求缓存按得分从高到低取出请求。
+// 评分函数可以使用请求的深度、域名、URL以及父页面请求的得分。
+type ScoreFunc func(req *DownloadRequest) float64
+
+// 广度优先：深度越浅越先爬取。
+func BFSStrategy(req *DownloadRequest) float64 {
+	return -float64(req.Depth())
+}
+
+// 深度优先：深度越深越先爬取。
+func DFSStrategy(req *DownloadRequest) float64 {
+	return float64(req.Depth())
+}
+
+// 最佳优先策略中的评分规则，Domain与Pattern均为空的规则匹配所有请求。
+type ScoreRule struct {
+	Domain  string         // 匹配的域名，包括其子域名。
+	Pattern *regexp.Regexp // 匹配的URL模式。
+	Score   float64        // 匹配时增加的得分。
+}
+
+// 判断规则是否匹配请求。
+func (rule ScoreRule) match(req *DownloadRequest) bool {
+	httpReq := req.HttpReq()
+	if httpReq == nil || httpReq.URL == nil {
+		return false
+	}
+	if rule.Domain != "" {
+		host := strings.ToLower(httpReq.URL.Hostname())
+		domain := strings.ToLower(rule.Domain)
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			return false
+		}
+	}
+	if rule.Pattern != nil && !rule.Pattern.MatchString(httpReq.URL.String()) {
+		return false
+	}
+	return true
+}
+
+// 创建最佳优先策略。
+// 得分为所有匹配规则的得分之和，加上父页面得分乘以parentWeight，再减去深度乘以depthWeight。
+func BestFirstStrategy(rules []ScoreRule, depthWeight float64, parentWeight float64) ScoreFunc {
+	return func(req *DownloadRequest) float64 {
+		var score float64
+		for _, rule := range rules {
+			if rule.match(req) {
+				score += rule.Score
+			}
+		}
+		score += parentWeight * req.ParentScore()
+		score -= depthWeight * float64(req.Depth())
+		return score
+	}
+}
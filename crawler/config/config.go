@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"sync"
 )
 
@@ -19,6 +21,40 @@ type Config struct {
 		User   string `yaml:user`
 		Passwd string `yaml:passwd`
 	}
+	Cookies []CookieConfig `yaml:"cookies"`
+}
+
+// 爬取开始前预置到Cookie容器中的一条Cookie，例如登录后的会话。
+type CookieConfig struct {
+	URL      string `yaml:"url"` // Cookie所属的URL，决定其默认的域名与路径。
+	Name     string `yaml:"name"`
+	Value    string `yaml:"value"`
+	Domain   string `yaml:"domain"`
+	Path     string `yaml:"path"`
+	Secure   bool   `yaml:"secure"`
+	HttpOnly bool   `yaml:"httponly"`
+}
+
+// 将配置中的Cookie设置到Cookie容器中。
+func SeedCookies(jar http.CookieJar, cookies []CookieConfig) error {
+	for _, c := range cookies {
+		u, err := url.Parse(c.URL)
+		if err != nil {
+			return err
+		}
+		if u.Host == "" || c.Name == "" {
+			return fmt.Errorf("The seed cookie is illegal. (url=%s, name=%s)", c.URL, c.Name)
+		}
+		jar.SetCookies(u, []*http.Cookie{{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}})
+	}
+	return nil
 }
 
 var instance *Config
@@ -1,8 +1,14 @@
 package config
 
 import (
-	"testing"
+	"chaoshen.com/crawlergo/crawler/downloader"
+	"context"
 	"fmt"
+	"gopkg.in/yaml.v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
 )
 
 func TestGetConfig(t *testing.T) {
@@ -10,3 +16,75 @@ func TestGetConfig(t *testing.T) {
 	fmt.Println(instance.Database.ConnectPool)
 	fmt.Println(GetDBConnectString())
 }
+
+func TestSeedCookies(t *testing.T) {
+	received := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := ""
+		if cookie, err := r.Cookie("sessionid"); err == nil {
+			value = cookie.Value
+		}
+		received <- r.Host + "=" + value
+	}))
+	defer server.Close()
+
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+cookies:
+    - url:    http://www.example.com/
+      name:   sessionid
+      value:  secret
+      domain: example.com
+`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Cookies) != 1 || config.Cookies[0].Domain != "example.com" {
+		t.Fatalf("Unexpected cookies %+v", config.Cookies)
+	}
+	jar, err := downloader.NewSessionJar("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SeedCookies(jar, config.Cookies); err != nil {
+		t.Fatal(err)
+	}
+
+	// 所有主机名都连接到测试服务器，Cookie只按主机名区分。
+	client := &http.Client{
+		Jar: jar,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		},
+	}
+	for _, host := range []string{"img.example.com", "www.example.org"} {
+		resp, err := client.Get("http://" + host + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if got := <-received; got != "img.example.com=secret" {
+		t.Errorf("The seed cookie should be sent to the matching host, got %q", got)
+	}
+	if got := <-received; got != "www.example.org=" {
+		t.Errorf("The seed cookie should not be sent to another host, got %q", got)
+	}
+}
+
+func TestSeedCookiesIllegal(t *testing.T) {
+	jar, err := downloader.NewSessionJar("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []CookieConfig{
+		{URL: "/relative", Name: "sessionid", Value: "secret"},
+		{URL: "http://www.example.com/", Value: "secret"},
+	} {
+		if err := SeedCookies(jar, []CookieConfig{c}); err == nil {
+			t.Errorf("The cookie %+v without host or name should be rejected.", c)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"chaoshen.com/crawlergo/crawler/basic"
 	"chaoshen.com/crawlergo/crawler/pageParser"
 	"chaoshen.com/crawlergo/crawler/pipeline"
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/astaxie/beego/logs"
-	"io"
 	"net/http"
 	"net/url"
 	"strings"
@@ -58,7 +57,7 @@ func main() {
 
 	intervalNs := 10 * time.Millisecond
 
-	scheduler.Start(req)
+	scheduler.Start(context.Background(), req)
 
 	flagChan := sched.Monitoring(scheduler, intervalNs, false)
 	if err != nil {
@@ -81,33 +80,15 @@ func getItemProcessor() []itemproc.ProcessItem {
 	return processor
 }
 
-func parseForATag(httpResp *http.Response, respDepth uint32) ([]basic.BaseData, []error) {
+func parseForATag(ctx context.Context, respond *basic.DownloadRespond) ([]basic.BaseData, []error) {
+	httpResp := respond.HttpResp()
 	if httpResp.StatusCode != 200 {
 		err := errors.New(
 			fmt.Sprintf("Unsupported status code %d. (httpResponse=%v)", httpResp))
 		return nil, []error{err}
 	}
-	defer func() {
-		if httpResp.Body != nil {
-			httpResp.Body.Close()
-		}
-	}()
-
-	bodyStr := make([]byte, 0)
-	buf := make([]byte, 1024)
-	for {
-		_, err := httpResp.Body.Read(buf) // 为这次读出的数据大小
-		if err != nil && err != io.EOF {
-			return nil, []error{err}
-		}
-		if err == io.EOF { /* && n != 0*/
-			bodyStr = append(bodyStr, buf...)
-			break
-		}
-		bodyStr = append(bodyStr, buf...)
-	}
 
-	doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(bodyStr))
+	doc, err := goquery.NewDocumentFromReader(respond.TextReader())
 	if err != nil {
 		return nil, []error{err}
 	}
@@ -137,7 +118,7 @@ func parseForATag(httpResp *http.Response, respDepth uint32) ([]basic.BaseData,
 			errorList = append(errorList, err)
 			return
 		}
-		dataList = append(dataList, basic.NewDownloadRequest(0, newReq, respDepth))
+		dataList = append(dataList, basic.NewDownloadRequest(0, newReq, respond.Depth()))
 		logs.Debug("Find new http request:%s.", url.String())
 	})
 
@@ -150,7 +131,7 @@ func parseForATag(httpResp *http.Response, respDepth uint32) ([]basic.BaseData,
 			}
 			imap["title"] = text
 			imap["url"] = httpResp.Request.URL.String()
-			imap["body"] = string(bodyStr)
+			imap["body"] = respond.Text()
 			item := basic.ItemMap(imap)
 			dataList = append(dataList, item)
 		}
@@ -159,7 +140,7 @@ func parseForATag(httpResp *http.Response, respDepth uint32) ([]basic.BaseData,
 	return dataList, errorList
 }
 
-func processItemPrint(itemMap basic.ItemMap) (basic.ItemMap, error) {
+func processItemPrint(ctx context.Context, itemMap basic.ItemMap) (basic.ItemMap, error) {
 	//logs.Info("ItemMap:")
 	var title string
 	var url string
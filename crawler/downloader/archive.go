@@ -0,0 +1,207 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/util"
+	"chaoshen.com/crawlergo/crawler/warc"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// WARC文件中一条响应记录的位置。
+type warcLocation struct {
+	path     string
+	position warc.Position
+}
+
+// 以WARC文件为内容的只读记录存储。打开时只建立URL到记录位置的索引，
+// 读取时再从文件中取出记录，同一URL有多条响应时使用最后一条。
+type warcStore struct {
+	lock          sync.Mutex
+	canonicalizer *util.URLCanonicalizer
+	index         map[string]warcLocation
+}
+
+// 以WARC文件创建只读的记录存储，可以作为WithReplay的存档。
+// 记录以规范化后的目标URL为键，与HTTP缓存一致。
+func NewWARCStore(canonicalizer *util.URLCanonicalizer, paths ...string) (ResponseStore, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("The warc files can not be empty.")
+	}
+	if canonicalizer == nil {
+		canonicalizer = util.NewURLCanonicalizer()
+	}
+	store := &warcStore{canonicalizer: canonicalizer, index: map[string]warcLocation{}}
+	for _, path := range paths {
+		if err := store.indexFile(path); err != nil {
+			return nil, fmt.Errorf("Index the warc file %s error: %s", path, err)
+		}
+	}
+	return store, nil
+}
+
+// 为WARC文件中的响应记录建立索引。
+func (store *warcStore) indexFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := warc.NewReader(file, 0)
+	if err != nil {
+		return err
+	}
+	for {
+		rec, position, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// 被拒绝的响应只有部分内容，回放时视为存档中没有该URL。
+		if rec.Type != warc.TYPE_RESPONSE || rec.TargetURI == "" || rec.Field(warc.FIELD_REJECTED) != "" {
+			continue
+		}
+		u, err := url.Parse(rec.TargetURI)
+		if err != nil {
+			continue
+		}
+		store.index[store.canonicalizer.Canonicalize(u)] = warcLocation{path: path, position: position}
+	}
+}
+
+func (store *warcStore) Get(key string) (*CacheEntry, error) {
+	store.lock.Lock()
+	location, ok := store.index[key]
+	store.lock.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	file, err := os.Open(location.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	rec, err := warc.ReadAt(file, location.position)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.Block)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	// 其他工具写入的WARC文件保存的是未解码的响应体。
+	var body []byte
+	reader, err := decodeBody(httpResp)
+	if err == nil && reader != nil {
+		body, err = ioutil.ReadAll(reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &CacheEntry{
+		URL:        rec.TargetURI,
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+		Body:       body,
+		StoredAt:   rec.Date,
+	}, nil
+}
+
+func (store *warcStore) Put(key string, entry *CacheEntry) error {
+	return errors.New("The warc store is read-only.")
+}
+
+// 从存档中读取响应的网页下载器，不访问网络。
+type replayDownloader struct {
+	id            uint32
+	store         ResponseStore
+	canonicalizer *util.URLCanonicalizer
+	policy        RedirectPolicy
+}
+
+// 创建从存档中读取响应的网页下载器，存档可以是NewWARCStore或NewFileResponseStore创建的存储。
+// 存档中没有的URL返回类型为basic.ARCHIVE_MISS_ERROR的basic.CrawlerError。
+// 存档的重定向响应与在线爬取时一样最多跟随DefaultMaxRedirects次。
+func NewReplayDownloader(store ResponseStore, canonicalizer *util.URLCanonicalizer) PageDownloader {
+	return NewReplayDownloaderWithPolicy(store, canonicalizer,
+		RedirectPolicy{MaxRedirects: DefaultMaxRedirects, Follow: true})
+}
+
+// 创建按重定向策略跟随存档中重定向响应的回放下载器，
+// 因此在线爬取时发生重定向的URL在回放时同样得到最终的响应。
+func NewReplayDownloaderWithPolicy(store ResponseStore, canonicalizer *util.URLCanonicalizer, policy RedirectPolicy) PageDownloader {
+	if canonicalizer == nil {
+		canonicalizer = util.NewURLCanonicalizer()
+	}
+	return &replayDownloader{id: genDownloaderId(), store: store, canonicalizer: canonicalizer, policy: policy}
+}
+
+func (dl *replayDownloader) Id() uint32 {
+	return dl.id
+}
+
+func (dl *replayDownloader) Download(req *basic.DownloadRequest) (*basic.DownloadRespond, error) {
+	httpReq := req.HttpReq()
+	if httpReq == nil || httpReq.URL == nil {
+		return nil, errors.New("The request to replay is invalid.")
+	}
+	var via []*http.Request
+	var chain []basic.Redirect
+	for {
+		entry, err := dl.store.Get(dl.canonicalizer.Canonicalize(httpReq.URL))
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return nil, basic.NewCrawlerError(basic.ARCHIVE_MISS_ERROR,
+				fmt.Sprintf("The url is not in the archive. (requestUrl=%s)", httpReq.URL))
+		}
+		respond := storedResponse(req.WithHttpReq(httpReq), entry)
+		respond.SetRedirects(chain)
+		httpResp := respond.HttpResp()
+		location := RedirectLocation(httpResp)
+		if location == nil {
+			return respond, nil
+		}
+		next, err := redirectRequest(httpReq, httpResp, location)
+		if err != nil {
+			return nil, err
+		}
+		via = append(via, httpReq)
+		if err := dl.policy.CheckRedirect(next, via); err == http.ErrUseLastResponse {
+			return respond, nil
+		} else if err != nil {
+			return nil, err
+		}
+		chain = append(chain, basic.Redirect{URL: httpReq.URL, StatusCode: httpResp.StatusCode})
+		httpReq = next
+	}
+}
+
+// 创建重定向的下一个请求，与HTTP客户端一样，307与308保持请求方法，其他重定向改为GET请求。
+// 回放只按URL查找响应，因此不需要请求体。
+func redirectRequest(httpReq *http.Request, httpResp *http.Response, location *url.URL) (*http.Request, error) {
+	method := httpReq.Method
+	if httpResp.StatusCode != http.StatusTemporaryRedirect && httpResp.StatusCode != http.StatusPermanentRedirect {
+		method = http.MethodGet
+	}
+	next, err := http.NewRequest(method, location.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	next = next.WithContext(httpReq.Context())
+	next.Header = httpReq.Header.Clone()
+	next.Response = httpResp
+	return next, nil
+}
@@ -0,0 +1,166 @@
+package downloader
+
+import (
+	"bytes"
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/warc"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWARCReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html>" + r.URL.Path + "</html>"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writer, err := warc.NewWriter(dir, "crawl", 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewMiddlewareDownloader(NewPageDownloader(nil), NewWARCMiddleware(writer))
+	for _, path := range []string{"/a", "/b", "/a"} {
+		httpReq, _ := http.NewRequest("GET", server.URL+path, nil)
+		if _, err := fetcher.Download(basic.NewDownloadRequest(1, httpReq, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+	server.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	store, err := NewWARCStore(nil, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl := NewReplayDownloader(store, nil)
+	download := func(rawUrl string) (*basic.DownloadRespond, error) {
+		httpReq, _ := http.NewRequest("GET", rawUrl, nil)
+		return dl.Download(basic.NewDownloadRequest(1, httpReq, 1))
+	}
+	for _, path := range []string{"/a", "/b"} {
+		respond, err := download(server.URL + path + "#fragment")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if respond.HttpResp().StatusCode != http.StatusOK || respond.Text() != "<html>"+path+"</html>" {
+			t.Fatalf("Unexpected replayed response: %d %q", respond.HttpResp().StatusCode, respond.Text())
+		}
+	}
+	_, err = download(server.URL + "/missing")
+	if crawlerErr, ok := err.(basic.CrawlerError); !ok || crawlerErr.Type() != basic.ARCHIVE_MISS_ERROR {
+		t.Fatalf("Expected archive miss error, got %v", err)
+	}
+}
+
+func TestWARCReplayRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, "/new", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html>new</html>"))
+		}
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writer, err := warc.NewWriter(dir, "crawl", 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewMiddlewareDownloader(NewPageDownloader(nil), NewWARCMiddleware(writer))
+	httpReq, _ := http.NewRequest("GET", server.URL+"/old", nil)
+	if _, err := fetcher.Download(basic.NewDownloadRequest(1, httpReq, 1)); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	server.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	store, err := NewWARCStore(nil, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	download := func(dl PageDownloader) (*basic.DownloadRespond, error) {
+		httpReq, _ := http.NewRequest("GET", server.URL+"/old", nil)
+		return dl.Download(basic.NewDownloadRequest(1, httpReq, 1))
+	}
+	respond, err := download(NewReplayDownloader(store, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if respond.Text() != "<html>new</html>" || respond.HttpResp().Request.URL.Path != "/new" {
+		t.Fatalf("Unexpected replayed response of %s: %q", respond.HttpResp().Request.URL, respond.Text())
+	}
+	if redirects := respond.Redirects(); len(redirects) != 2 || redirects[0].URL.Path != "/old" ||
+		redirects[1].StatusCode != http.StatusFound {
+		t.Fatalf("Unexpected replayed redirects: %v", redirects)
+	}
+
+	// 不跟随重定向时返回存档的重定向响应，超过次数限制时返回重定向错误。
+	respond, err = download(NewReplayDownloaderWithPolicy(store, nil, RedirectPolicy{}))
+	if err != nil || respond.HttpResp().StatusCode != http.StatusMovedPermanently {
+		t.Fatalf("Expected the archived redirect response, got %v", err)
+	}
+	_, err = download(NewReplayDownloaderWithPolicy(store, nil, RedirectPolicy{MaxRedirects: 1, Follow: true}))
+	if crawlerErr, ok := err.(basic.CrawlerError); !ok || crawlerErr.Type() != basic.REDIRECT_ERROR {
+		t.Fatalf("Expected redirect error, got %v", err)
+	}
+}
+
+func TestWARCStoreDecodesBody(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writer, err := warc.NewWriter(dir, "crawl", 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 其他工具写入的记录保存压缩的响应体与Content-Encoding头。
+	var body bytes.Buffer
+	gzipWriter := gzip.NewWriter(&body)
+	gzipWriter.Write([]byte("<html>gzip</html>"))
+	gzipWriter.Close()
+	block := "HTTP/1.1 200 OK\r\nContent-Encoding: gzip\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" + body.String()
+	rec := &warc.Record{Type: warc.TYPE_RESPONSE, TargetURI: "http://a.com/gzip",
+		ContentType: "application/http;msgtype=response", Block: []byte(block)}
+	if err := writer.WriteRecords(rec); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	store, err := NewWARCStore(nil, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq, _ := http.NewRequest("GET", "http://a.com/gzip", nil)
+	respond, err := NewReplayDownloader(store, nil).Download(basic.NewDownloadRequest(1, httpReq, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if respond.Text() != "<html>gzip</html>" || respond.HttpResp().Header.Get("Content-Encoding") != "" {
+		t.Fatalf("Expected the decoded body, got %q with Content-Encoding %q.",
+			respond.Text(), respond.HttpResp().Header.Get("Content-Encoding"))
+	}
+}
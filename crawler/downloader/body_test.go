@@ -0,0 +1,161 @@
+package downloader
+
+import (
+	"bytes"
+	"chaoshen.com/crawlergo/crawler/basic"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadReadsBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		writer.Write([]byte("<html>hello</html>"))
+		writer.Close()
+	}))
+	defer server.Close()
+
+	httpReq, _ := http.NewRequest("GET", server.URL, nil)
+	httpReq.Header.Set("Accept-Encoding", "gzip")
+	respond, err := NewPageDownloader(nil).Download(basic.NewDownloadRequest(1, httpReq, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(respond.Body()) != "<html>hello</html>" || respond.Truncated() {
+		t.Fatalf("Unexpected body %q.", respond.Body())
+	}
+	// 每个副本都能从头读取响应体。
+	for i := 0; i < 2; i++ {
+		clone := respond.Clone()
+		body, _ := ioutil.ReadAll(clone.HttpResp().Body)
+		clone.HttpResp().Body.Close()
+		if string(body) != "<html>hello</html>" {
+			t.Fatalf("Read %q from clone %d.", body, i)
+		}
+	}
+}
+
+func TestReadBodyTruncated(t *testing.T) {
+	httpResp := &http.Response{
+		Header: http.Header{},
+		Body:   ioutil.NopCloser(strings.NewReader("0123456789")),
+	}
+	body, truncated, err := readBody(httpResp, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !truncated || !bytes.Equal(body, []byte("0123")) {
+		t.Errorf("Read (%q, %v), expected (\"0123\", true).", body, truncated)
+	}
+}
+
+func TestReadBodyEmptyGzip(t *testing.T) {
+	httpResp := &http.Response{
+		StatusCode: http.StatusNoContent,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       http.NoBody,
+	}
+	body, truncated, err := readBody(httpResp, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 0 || truncated {
+		t.Errorf("Read (%q, %v), expected an empty body.", body, truncated)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		httpReq, _ := http.NewRequest(method, server.URL, nil)
+		httpReq.Header.Set("Accept-Encoding", "gzip")
+		respond, err := NewPageDownloader(nil).Download(basic.NewDownloadRequest(1, httpReq, 1))
+		if err != nil {
+			t.Fatalf("Download a 304 response by %s got error: %s", method, err)
+		}
+		if respond.HttpResp().StatusCode != http.StatusNotModified || len(respond.Body()) != 0 {
+			t.Fatalf("Expected an empty 304 response, got %d %q.", respond.HttpResp().StatusCode, respond.Body())
+		}
+	}
+}
+
+func TestDownloadLimits(t *testing.T) {
+	heads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads++
+		}
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(strings.Repeat("a", 100)))
+		case "/video.mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+			if r.Method == http.MethodGet {
+				t.Error("The probed video should not be downloaded.")
+			}
+		}
+	}))
+	defer server.Close()
+
+	limits := basic.NewDownloadLimitConfig(10, basic.OVERSIZE_REJECT, "text/html")
+	limits.SetProbeExtensions(basic.DefaultProbeExtensions...)
+	dl := NewPageDownloaderWithLimits(nil, limits)
+	download := func(path string) (*basic.DownloadRespond, error) {
+		httpReq, _ := http.NewRequest("GET", server.URL+path, nil)
+		return dl.Download(basic.NewDownloadRequest(1, httpReq, 1))
+	}
+
+	respond, err := download("/page")
+	if ce, ok := err.(basic.CrawlerError); respond != nil || !ok || ce.Type() != basic.RESPONSE_TOO_LARGE_ERROR {
+		t.Errorf("Download an oversize page got (%v, %v), expected a too large error.", respond, err)
+	}
+	respond, err = download("/video.mp4")
+	if ce, ok := err.(basic.CrawlerError); respond != nil || !ok || ce.Type() != basic.CONTENT_TYPE_ERROR {
+		t.Errorf("Download a video got (%v, %v), expected a content type error.", respond, err)
+	}
+	if heads != 1 {
+		t.Errorf("Sent %d HEAD requests, expected 1.", heads)
+	}
+
+	dl = NewPageDownloaderWithLimits(nil, basic.NewDownloadLimitConfig(10, basic.OVERSIZE_TRUNCATE))
+	respond, err = download("/page")
+	if err != nil || !respond.Truncated() || len(respond.Body()) != 10 {
+		t.Errorf("Download an oversize page got (%v, %v), expected a truncated response.", respond, err)
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	// "中文"的GBK编码。
+	gbk := []byte{0xd6, 0xd0, 0xce, 0xc4}
+	cases := []struct {
+		body        []byte
+		contentType string
+		encoding    string
+	}{
+		{gbk, "text/html; charset=gb2312", "gbk"},
+		{append([]byte(`<html><head><meta charset="gbk"></head><body>`), gbk...), "text/html", "gbk"},
+		{[]byte("\xef\xbb\xbf中文"), "text/html", "utf-8"},
+		{[]byte("中文"), "", "utf-8"},
+	}
+	for _, c := range cases {
+		text, encoding, err := decodeText(c.body, c.contentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoding != c.encoding || !strings.HasSuffix(string(text), "中文") ||
+			strings.HasPrefix(string(text), "\xef\xbb\xbf") {
+			t.Errorf("Decode %q got (%q, %s), expected the encoding %s.", c.body, text, encoding, c.encoding)
+		}
+	}
+	if isTextContent("image/png") || !isTextContent("application/xhtml+xml") {
+		t.Error("Unexpected text content detection.")
+	}
+}
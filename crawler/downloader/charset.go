@@ -0,0 +1,45 @@
+package downloader
+
+import (
+	"bytes"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/transform"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// 判断内容类型是否为需要转换编码的文本，内容类型为空时视为文本。
+func isTextContent(contentType string) bool {
+	if strings.TrimSpace(contentType) == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		strings.HasSuffix(mediaType, "/xml") ||
+		strings.HasSuffix(mediaType, "/json") ||
+		strings.HasSuffix(mediaType, "/javascript")
+}
+
+// 依次根据BOM、Content-Type的charset参数与<meta charset>检测响应体的字符编码，
+// 并转换为UTF-8，返回转换后的文本与原始编码的名称。
+func decodeText(body []byte, contentType string) ([]byte, string, error) {
+	enc, name, certain := charset.DetermineEncoding(body, contentType)
+	// 前1024字节中没有声明且都是ASCII时会默认为windows-1252，此时按整个响应体再判断一次UTF-8。
+	if !certain && name == "windows-1252" && utf8.Valid(body) {
+		return body, "utf-8", nil
+	}
+	if name == "utf-8" {
+		return bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), name, nil
+	}
+	text, err := ioutil.ReadAll(transform.NewReader(bytes.NewReader(body), enc.NewDecoder()))
+	if err != nil {
+		return nil, name, err
+	}
+	return text, name, nil
+}
@@ -0,0 +1,162 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/util"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 由所有网页下载器共享的Cookie容器的接口类型。
+type SessionJar interface {
+	http.CookieJar
+	Save() error     // 将Cookie保存到文件，未指定文件时不做任何事。
+	Close() error    // 保存并关闭。
+	Summary() string // 获得摘要信息。
+}
+
+// 保存到文件中的一条Cookie。
+type storedCookie struct {
+	URL    string       `json:"url"`
+	Cookie *http.Cookie `json:"cookie"`
+}
+
+// 按主域名划分作用域的Cookie容器的实现类型。
+// net/http/cookiejar无法列出已有的Cookie，因此另行记录每次设置的Cookie用于持久化。
+type sessionJarImpl struct {
+	jar     *cookiejar.Jar
+	path    string
+	lock    sync.Mutex
+	records map[string]storedCookie // 以名称、域名与路径为键。
+}
+
+// 创建Cookie容器。path不为空时从该文件恢复已保存的Cookie，并在Save与Close时写回。
+// 同一主域名（见util.GetPrimaryDomain）下的主机可以共享以Domain属性设置的Cookie。
+func NewSessionJar(path string) (SessionJar, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: primaryDomainSuffixList{}})
+	if err != nil {
+		return nil, err
+	}
+	sessionJar := &sessionJarImpl{jar: jar, path: path, records: map[string]storedCookie{}}
+	if path == "" {
+		return sessionJar, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return sessionJar, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored []storedCookie
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, record := range stored {
+		if record.Cookie == nil || (!record.Cookie.Expires.IsZero() && !record.Cookie.Expires.After(now)) {
+			continue
+		}
+		u, err := url.Parse(record.URL)
+		if err != nil {
+			return nil, err
+		}
+		sessionJar.SetCookies(u, []*http.Cookie{record.Cookie})
+	}
+	return sessionJar, nil
+}
+
+func (sj *sessionJarImpl) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	sj.jar.SetCookies(u, cookies)
+	sj.lock.Lock()
+	defer sj.lock.Unlock()
+	now := time.Now()
+	for _, cookie := range cookies {
+		stored := *cookie
+		if stored.Domain == "" {
+			stored.Domain = u.Hostname()
+		}
+		key := stored.Name + "|" + strings.ToLower(strings.TrimPrefix(stored.Domain, ".")) + "|" + stored.Path
+		if stored.MaxAge > 0 {
+			stored.Expires = now.Add(time.Duration(stored.MaxAge) * time.Second)
+			stored.MaxAge = 0
+		}
+		if stored.MaxAge < 0 || (!stored.Expires.IsZero() && !stored.Expires.After(now)) {
+			delete(sj.records, key)
+			continue
+		}
+		// 未设置Domain属性的Cookie只属于该主机，恢复时同样不带Domain属性。
+		if cookie.Domain == "" {
+			stored.Domain = ""
+		}
+		stored.Raw = ""
+		stored.Unparsed = nil
+		// 保留请求的路径，使未设置Path属性的Cookie恢复时得到相同的默认路径。
+		sj.records[key] = storedCookie{URL: u.Scheme + "://" + u.Host + u.EscapedPath(), Cookie: &stored}
+	}
+}
+
+func (sj *sessionJarImpl) Cookies(u *url.URL) []*http.Cookie {
+	return sj.jar.Cookies(u)
+}
+
+// 先写入临时文件再重命名，避免留下写了一半的文件。
+func (sj *sessionJarImpl) Save() error {
+	if sj.path == "" {
+		return nil
+	}
+	sj.lock.Lock()
+	stored := make([]storedCookie, 0, len(sj.records))
+	for _, record := range sj.records {
+		stored = append(stored, record)
+	}
+	sj.lock.Unlock()
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	tmpPath := sj.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, sj.path)
+}
+
+func (sj *sessionJarImpl) Close() error {
+	return sj.Save()
+}
+
+func (sj *sessionJarImpl) Summary() string {
+	sj.lock.Lock()
+	defer sj.lock.Unlock()
+	path := sj.path
+	if path == "" {
+		path = "<memory>"
+	}
+	return fmt.Sprintf("cookies: %d, path: %s", len(sj.records), path)
+}
+
+// 以主域名确定Cookie作用域的公共后缀列表：主域名去掉第一段即为其公共后缀。
+type primaryDomainSuffixList struct{}
+
+func (primaryDomainSuffixList) PublicSuffix(domain string) string {
+	primary, err := util.GetPrimaryDomain(domain)
+	if err != nil {
+		return domain[strings.LastIndex(domain, ".")+1:]
+	}
+	if index := strings.Index(primary, "."); index >= 0 {
+		return primary[index+1:]
+	}
+	return primary
+}
+
+func (primaryDomainSuffixList) String() string {
+	return "primary domain"
+}
@@ -0,0 +1,49 @@
+package downloader
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionJarPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cookiejar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cookies.json")
+	jar, err := NewSessionJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse("http://www.a.com/login")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "s1", Domain: "a.com", Path: "/"},
+		{Name: "host", Value: "h1", MaxAge: 3600},
+		{Name: "gone", Value: "g1", MaxAge: -1},
+	})
+	// 同一主域名下的其他主机共享以Domain属性设置的Cookie。
+	other, _ := url.Parse("http://img.a.com/")
+	if cookies := jar.Cookies(other); len(cookies) != 1 || cookies[0].Value != "s1" {
+		t.Fatalf("Unexpected cookies for %s: %v", other, cookies)
+	}
+	if err := jar.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	jar, err = NewSessionJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := jar.Cookies(u)
+	if len(cookies) != 2 {
+		t.Fatalf("Unexpected cookies after reload: %v", cookies)
+	}
+	if cookies := jar.Cookies(other); len(cookies) != 1 {
+		t.Fatalf("The host-only cookie should not be shared: %v", cookies)
+	}
+}
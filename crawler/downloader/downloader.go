@@ -1,12 +1,19 @@
 package downloader
 
 import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"chaoshen.com/crawlergo/crawler/basic"
 	"chaoshen.com/crawlergo/crawler/util"
 	"github.com/astaxie/beego/logs"
 )
 
+
 // 日志记录器。
 
 // ID生成器。
@@ -23,8 +30,14 @@ type PageDownloader interface {
 	Download(req *basic.DownloadRequest) (*basic.DownloadRespond, error) // 根据请求下载网页并返回响应。
 }
 
-// 创建网页下载器。
+// 创建网页下载器，响应体超过basic.DefaultMaxBodySize的部分会被截断。
 func NewPageDownloader(client *http.Client) PageDownloader {
+	return NewPageDownloaderWithLimits(client,
+		basic.NewDownloadLimitConfig(basic.DefaultMaxBodySize, basic.OVERSIZE_TRUNCATE))
+}
+
+// 创建带有下载限制的网页下载器。
+func NewPageDownloaderWithLimits(client *http.Client, limits basic.DownloadLimitConfig) PageDownloader {
 	id := genDownloaderId()
 	if client == nil {
 		client = &http.Client{}
@@ -32,25 +45,160 @@ func NewPageDownloader(client *http.Client) PageDownloader {
 	return &pageDownloaderImpl{
 		id:         id,
 		httpClient: *client,
+		limits:     limits,
 	}
 }
 
 // 网页下载器的实现类型。
 type pageDownloaderImpl struct {
-	id         uint32      // ID。
-	httpClient http.Client // HTTP客户端。
+	id         uint32                    // ID。
+	httpClient http.Client               // HTTP客户端。
+	limits     basic.DownloadLimitConfig // 下载限制。
 }
 
 func (dl *pageDownloaderImpl) Id() uint32 {
 	return dl.id
 }
 
+// 因下载限制被拒绝的响应的错误，保留响应头与拒绝前已读取的响应体，以便归档。
+type RejectedError struct {
+	basic.CrawlerError
+	Response *http.Response // 被拒绝的响应，响应体已关闭。
+	Body     []byte         // 拒绝前已读取的响应体，未读取响应体时为nil。
+}
+
+func (err *RejectedError) Unwrap() error {
+	return err.CrawlerError
+}
+
+// 下载网页。超过大小上限且设置为拒绝、或内容类型不被允许的响应，
+// 返回*RejectedError，其类型为basic.RESPONSE_TOO_LARGE_ERROR或basic.CONTENT_TYPE_ERROR。
 func (dl *pageDownloaderImpl) Download(req *basic.DownloadRequest) (*basic.DownloadRespond, error) {
 	httpReq := req.HttpReq()
+	if dl.limits.ShouldProbe(httpReq.URL) {
+		if err := dl.probe(httpReq); err != nil {
+			return nil, err
+		}
+	}
 	logs.Info("Do the request (url=%s)... \n", httpReq.URL)
-	httpResp, err := dl.httpClient.Do(httpReq)
+	recorder := newTimingRecorder()
+	httpResp, err := dl.httpClient.Do(recorder.trace(httpReq))
+	if err != nil {
+		// 重定向策略返回的错误被包装在url.Error中。
+		var crawlerErr basic.CrawlerError
+		if errors.As(err, &crawlerErr) {
+			return nil, crawlerErr
+		}
+		return nil, err
+	}
+	if err := dl.checkHeader(httpResp); err != nil {
+		httpResp.Body.Close()
+		return nil, &RejectedError{CrawlerError: err, Response: httpResp}
+	}
+	respond := basic.NewDownloadResponseFor(req, httpResp)
+	respond.SetRedirects(redirectChain(httpResp))
+	body, truncated, err := readBody(httpResp, dl.limits.MaxBodySize())
+	if err != nil {
+		return nil, err
+	}
+	if truncated && dl.limits.OversizeAction() == basic.OVERSIZE_REJECT {
+		return nil, &RejectedError{
+			CrawlerError: basic.NewCrawlerError(basic.RESPONSE_TOO_LARGE_ERROR,
+				fmt.Sprintf("The response body exceeds %d bytes. (requestUrl=%s)",
+					dl.limits.MaxBodySize(), httpReq.URL)),
+			Response: httpResp,
+			Body:     body,
+		}
+	}
+	respond.SetBody(body, truncated)
+	respond.SetTiming(recorder.finish())
+	if contentType := httpResp.Header.Get("Content-Type"); isTextContent(contentType) {
+		if text, encoding, err := decodeText(body, contentType); err == nil {
+			respond.SetText(text, encoding)
+		} else {
+			logs.Warning("Decode the response body from %s error: %s. (requestUrl=%s)",
+				encoding, err, httpReq.URL)
+		}
+	}
+	return respond, nil
+}
+
+// 以HEAD请求探测响应的大小与内容类型，探测失败时不阻止下载。
+func (dl *pageDownloaderImpl) probe(httpReq *http.Request) error {
+	headReq, err := http.NewRequest(http.MethodHead, httpReq.URL.String(), nil)
+	if err != nil {
+		return nil
+	}
+	headReq = headReq.WithContext(httpReq.Context())
+	for key, values := range httpReq.Header {
+		headReq.Header[key] = values
+	}
+	logs.Info("Probe the request (url=%s)... \n", httpReq.URL)
+	headResp, err := dl.httpClient.Do(headReq)
+	if err != nil {
+		return nil
+	}
+	headResp.Body.Close()
+	if headResp.StatusCode != http.StatusOK {
+		return nil
+	}
+	if err := dl.checkHeader(headResp); err != nil {
+		return &RejectedError{CrawlerError: err, Response: headResp}
+	}
+	return nil
+}
+
+// 在读取响应体之前检查内容类型与声明的长度。
+func (dl *pageDownloaderImpl) checkHeader(httpResp *http.Response) basic.CrawlerError {
+	reqUrl := httpResp.Request.URL
+	contentType := httpResp.Header.Get("Content-Type")
+	if !dl.limits.AllowContentType(contentType) {
+		return basic.NewCrawlerError(basic.CONTENT_TYPE_ERROR,
+			fmt.Sprintf("The content type '%s' is not allowed. (requestUrl=%s)", contentType, reqUrl))
+	}
+	if dl.limits.OversizeAction() == basic.OVERSIZE_REJECT &&
+		httpResp.ContentLength > dl.limits.MaxBodySize() {
+		return basic.NewCrawlerError(basic.RESPONSE_TOO_LARGE_ERROR,
+			fmt.Sprintf("The content length %d exceeds %d bytes. (requestUrl=%s)",
+				httpResp.ContentLength, dl.limits.MaxBodySize(), reqUrl))
+	}
+	return nil
+}
+
+// 读取并关闭响应体，按Content-Encoding解码，最多读取maxSize字节。
+func readBody(httpResp *http.Response, maxSize int64) ([]byte, bool, error) {
+	if httpResp.Body == nil {
+		return nil, false, nil
+	}
+	defer httpResp.Body.Close()
+	reader, err := decodeBody(httpResp)
+	if err != nil || reader == nil {
+		return nil, false, err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > maxSize {
+		return body[:maxSize], true, nil
+	}
+	return body, false, nil
+}
+
+// 按Content-Encoding返回解码响应体的读取器，并删除Content-Encoding头。
+// 请求自行设置了Accept-Encoding时，HTTP客户端不会自动解压。
+// 204/304或HEAD响应即使声明了gzip也没有响应体，此时返回nil。
+func decodeBody(httpResp *http.Response) (io.Reader, error) {
+	if !strings.EqualFold(strings.TrimSpace(httpResp.Header.Get("Content-Encoding")), "gzip") {
+		return httpResp.Body, nil
+	}
+	httpResp.Header.Del("Content-Encoding")
+	gzipReader, err := gzip.NewReader(httpResp.Body)
+	if err == io.EOF {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	return basic.NewDownloadResponse(req.GetID(),httpResp, req.Depth()), nil
+	return gzipReader, nil
 }
@@ -0,0 +1,197 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/util"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HTTP缓存中的一条记录。
+type CacheEntry struct {
+	URL          string      `json:"url"`
+	StatusCode   int         `json:"statusCode"`
+	Header       http.Header `json:"header"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastModified,omitempty"`
+	Body         []byte      `json:"body"`
+	StoredAt     time.Time   `json:"storedAt"`
+}
+
+// HTTP缓存记录存储的接口类型。
+type ResponseStore interface {
+	Get(key string) (*CacheEntry, error) // 获得记录，不存在时返回nil。
+	Put(key string, entry *CacheEntry) error
+}
+
+// 基于本地目录的记录存储，每条记录保存为一个以键的SHA1命名的文件。
+type fileResponseStore struct {
+	dir string
+}
+
+// 创建基于本地目录的记录存储。
+func NewFileResponseStore(dir string) (ResponseStore, error) {
+	if dir == "" {
+		return nil, errors.New("The response store directory can not be empty.")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileResponseStore{dir: dir}, nil
+}
+
+func (store *fileResponseStore) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(store.dir, name[:2], name+".json")
+}
+
+func (store *fileResponseStore) Get(key string) (*CacheEntry, error) {
+	data, err := ioutil.ReadFile(store.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &CacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// 先写入临时文件再重命名，避免读到写了一半的记录。
+func (store *fileResponseStore) Put(key string, entry *CacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	path := store.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// 带有HTTP条件请求缓存的网页下载器。
+// 对于GET请求，已缓存的URL会带上If-None-Match与If-Modified-Since，
+// 服务器返回304时以缓存的响应代替，并标记为未修改。
+type cachingDownloader struct {
+	PageDownloader
+	store         ResponseStore
+	canonicalizer *util.URLCanonicalizer
+}
+
+// 为网页下载器加上HTTP条件请求缓存，缓存记录以规范化后的URL为键。
+func NewCachingDownloader(dl PageDownloader,
+	store ResponseStore,
+	canonicalizer *util.URLCanonicalizer) PageDownloader {
+	if canonicalizer == nil {
+		canonicalizer = util.NewURLCanonicalizer()
+	}
+	return &cachingDownloader{PageDownloader: dl, store: store, canonicalizer: canonicalizer}
+}
+
+func (dl *cachingDownloader) Download(req *basic.DownloadRequest) (*basic.DownloadRespond, error) {
+	httpReq := req.HttpReq()
+	if httpReq == nil || httpReq.URL == nil || httpReq.Method != http.MethodGet {
+		return dl.PageDownloader.Download(req)
+	}
+	key := dl.canonicalizer.Canonicalize(httpReq.URL)
+	entry, err := dl.store.Get(key)
+	if err != nil {
+		logs.Warning("Read the http cache error: %s. (requestUrl=%s)", err, httpReq.URL)
+	}
+	dlReq := req
+	if entry != nil {
+		condReq := *httpReq
+		condReq.Header = cloneHeader(httpReq.Header)
+		if entry.ETag != "" {
+			condReq.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			condReq.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+		dlReq = req.WithHttpReq(&condReq)
+	}
+	respond, err := dl.PageDownloader.Download(dlReq)
+	if err != nil {
+		return nil, err
+	}
+	httpResp := respond.HttpResp()
+	if entry != nil && httpResp.StatusCode == http.StatusNotModified {
+		return cachedResponse(req, entry), nil
+	}
+	if httpResp.StatusCode == http.StatusOK && !respond.Truncated() &&
+		(httpResp.Header.Get("ETag") != "" || httpResp.Header.Get("Last-Modified") != "") {
+		if err := dl.store.Put(key, newCacheEntry(httpReq, respond)); err != nil {
+			logs.Warning("Write the http cache error: %s. (requestUrl=%s)", err, httpReq.URL)
+		}
+	}
+	return respond, nil
+}
+
+// 根据响应创建缓存记录。
+func newCacheEntry(httpReq *http.Request, respond *basic.DownloadRespond) *CacheEntry {
+	httpResp := respond.HttpResp()
+	return &CacheEntry{
+		URL:          httpReq.URL.String(),
+		StatusCode:   httpResp.StatusCode,
+		Header:       httpResp.Header,
+		ETag:         httpResp.Header.Get("ETag"),
+		LastModified: httpResp.Header.Get("Last-Modified"),
+		Body:         respond.Body(),
+		StoredAt:     time.Now(),
+	}
+}
+
+// 以缓存记录创建标记为未修改的响应。
+func cachedResponse(req *basic.DownloadRequest, entry *CacheEntry) *basic.DownloadRespond {
+	respond := storedResponse(req, entry)
+	respond.SetNotModified(true)
+	return respond
+}
+
+// 以存储的记录创建响应。
+func storedResponse(req *basic.DownloadRequest, entry *CacheEntry) *basic.DownloadRespond {
+	httpResp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode)),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cloneHeader(entry.Header),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req.HttpReq(),
+	}
+	respond := basic.NewDownloadResponseFor(req, httpResp)
+	respond.SetBody(entry.Body, false)
+	if contentType := httpResp.Header.Get("Content-Type"); isTextContent(contentType) {
+		if text, encoding, err := decodeText(entry.Body, contentType); err == nil {
+			respond.SetText(text, encoding)
+		}
+	}
+	return respond
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for key, values := range header {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
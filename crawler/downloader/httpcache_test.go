@@ -0,0 +1,57 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestCachingDownloader(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>cached</html>"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "httpcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewFileResponseStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl := NewCachingDownloader(NewPageDownloader(nil), store, nil)
+	download := func() *basic.DownloadRespond {
+		httpReq, _ := http.NewRequest("GET", server.URL+"/page#top", nil)
+		respond, err := dl.Download(basic.NewDownloadRequest(1, httpReq, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return respond
+	}
+
+	if respond := download(); respond.NotModified() {
+		t.Fatal("The first response should not be marked as not modified.")
+	}
+	respond := download()
+	if requests != 2 {
+		t.Fatalf("Sent %d requests, expected 2.", requests)
+	}
+	if !respond.NotModified() || respond.HttpResp().StatusCode != http.StatusOK ||
+		respond.Text() != "<html>cached</html>" {
+		t.Errorf("Unexpected cached response (notModified=%v, status=%d, text=%q).",
+			respond.NotModified(), respond.HttpResp().StatusCode, respond.Text())
+	}
+}
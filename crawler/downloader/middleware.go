@@ -0,0 +1,143 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 中间件丢弃请求时返回的错误，调度器不会将其视为下载失败。
+var ErrDropRequest = errors.New("The request is dropped by middleware.")
+
+// 中间件要求稍后重新调度请求时返回的错误，重新调度计入请求的尝试次数。
+type RescheduleError struct {
+	Request *basic.DownloadRequest // 重新调度的请求，为nil时使用原请求。
+	Delay   time.Duration          // 重新调度前等待的时间。
+}
+
+// 创建重新调度的错误。
+func NewRescheduleError(req *basic.DownloadRequest, delay time.Duration) *RescheduleError {
+	return &RescheduleError{Request: req, Delay: delay}
+}
+
+func (err *RescheduleError) Error() string {
+	return fmt.Sprintf("The request is rescheduled after %s.", err.Delay)
+}
+
+// 网页下载器中间件的接口类型。
+// 中间件按注册的顺序处理请求，按相反的顺序处理响应与错误。
+// 返回ErrDropRequest可以丢弃请求，返回*RescheduleError可以要求稍后重新调度。
+type Middleware interface {
+	// 在下载前处理请求。返回的请求不为nil时替换原请求，
+	// 返回的响应不为nil时不再下载，直接以该响应进入响应处理。
+	ProcessRequest(req *basic.DownloadRequest) (*basic.DownloadRequest, *basic.DownloadRespond, error)
+	// 处理下载得到的响应，返回的响应代替原响应，返回nil时丢弃请求。
+	ProcessResponse(req *basic.DownloadRequest, respond *basic.DownloadRespond) (*basic.DownloadRespond, error)
+	// 处理下载或其他中间件产生的错误。返回的响应不为nil时错误被恢复，
+	// 否则返回的错误（可以是原错误）继续交给之前注册的中间件处理。
+	ProcessError(req *basic.DownloadRequest, err error) (*basic.DownloadRespond, error)
+}
+
+// 不做任何处理的中间件，可以嵌入其他中间件中只实现需要的方法。
+type BaseMiddleware struct{}
+
+func (BaseMiddleware) ProcessRequest(req *basic.DownloadRequest) (*basic.DownloadRequest, *basic.DownloadRespond, error) {
+	return req, nil, nil
+}
+
+func (BaseMiddleware) ProcessResponse(req *basic.DownloadRequest, respond *basic.DownloadRespond) (*basic.DownloadRespond, error) {
+	return respond, nil
+}
+
+func (BaseMiddleware) ProcessError(req *basic.DownloadRequest, err error) (*basic.DownloadRespond, error) {
+	return nil, err
+}
+
+// 带有中间件链的网页下载器。
+type middlewareDownloader struct {
+	PageDownloader
+	middlewares []Middleware
+}
+
+// 为网页下载器加上按顺序执行的中间件链。
+func NewMiddlewareDownloader(dl PageDownloader, middlewares ...Middleware) PageDownloader {
+	return &middlewareDownloader{PageDownloader: dl, middlewares: middlewares}
+}
+
+func (dl *middlewareDownloader) Download(req *basic.DownloadRequest) (*basic.DownloadRespond, error) {
+	var respond *basic.DownloadRespond
+	var err error
+	// 已经处理过请求的中间件数，只有这些中间件会处理响应与错误。
+	processed := 0
+	for _, mw := range dl.middlewares {
+		var next *basic.DownloadRequest
+		next, respond, err = mw.ProcessRequest(req)
+		processed++
+		if next != nil {
+			req = next
+		}
+		if err != nil || respond != nil {
+			break
+		}
+	}
+	if err == nil && respond == nil {
+		respond, err = dl.PageDownloader.Download(req)
+	}
+	for i := processed - 1; i >= 0; i-- {
+		mw := dl.middlewares[i]
+		if err != nil {
+			if isControlError(err) {
+				return nil, err
+			}
+			respond, err = mw.ProcessError(req, err)
+		} else {
+			respond, err = mw.ProcessResponse(req, respond)
+		}
+		// 中间件丢弃了请求，外层的中间件不再处理。
+		if err == nil && respond == nil {
+			return nil, ErrDropRequest
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if respond == nil {
+		return nil, ErrDropRequest
+	}
+	return respond, nil
+}
+
+// 丢弃与重新调度不是错误，不再交给中间件处理。
+func isControlError(err error) bool {
+	var reschedule *RescheduleError
+	return errors.Is(err, ErrDropRequest) || errors.As(err, &reschedule)
+}
+
+// 轮换User-Agent的中间件。
+type userAgentMiddleware struct {
+	BaseMiddleware
+	agents []string
+	next   uint32
+}
+
+// 创建依次为请求设置User-Agent的中间件，请求已设置User-Agent时保持不变。
+func NewUserAgentMiddleware(agents ...string) (Middleware, error) {
+	if len(agents) == 0 {
+		return nil, errors.New("The user agents can not be empty.")
+	}
+	return &userAgentMiddleware{agents: agents}, nil
+}
+
+func (mw *userAgentMiddleware) ProcessRequest(req *basic.DownloadRequest) (*basic.DownloadRequest, *basic.DownloadRespond, error) {
+	httpReq := req.HttpReq()
+	if httpReq == nil || httpReq.Header.Get("User-Agent") != "" {
+		return req, nil, nil
+	}
+	index := (atomic.AddUint32(&mw.next, 1) - 1) % uint32(len(mw.agents))
+	uaReq := *httpReq
+	uaReq.Header = cloneHeader(httpReq.Header)
+	uaReq.Header.Set("User-Agent", mw.agents[index])
+	return req.WithHttpReq(&uaReq), nil, nil
+}
@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 记录调用顺序的中间件。
+type recordMiddleware struct {
+	BaseMiddleware
+	name  string
+	calls *[]string
+}
+
+func (mw recordMiddleware) ProcessRequest(req *basic.DownloadRequest) (*basic.DownloadRequest, *basic.DownloadRespond, error) {
+	*mw.calls = append(*mw.calls, "request:"+mw.name)
+	return req, nil, nil
+}
+
+func (mw recordMiddleware) ProcessResponse(req *basic.DownloadRequest, respond *basic.DownloadRespond) (*basic.DownloadRespond, error) {
+	*mw.calls = append(*mw.calls, "response:"+mw.name)
+	return respond, nil
+}
+
+// 将指定路径的请求丢弃或重新调度的中间件。
+type controlMiddleware struct {
+	BaseMiddleware
+}
+
+func (controlMiddleware) ProcessRequest(req *basic.DownloadRequest) (*basic.DownloadRequest, *basic.DownloadRespond, error) {
+	switch req.HttpReq().URL.Path {
+	case "/drop":
+		return nil, nil, ErrDropRequest
+	case "/later":
+		return nil, nil, NewRescheduleError(nil, time.Second)
+	}
+	return req, nil, nil
+}
+
+func TestMiddlewareDownloader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(r.Header.Get("User-Agent")))
+	}))
+	defer server.Close()
+
+	var calls []string
+	ua, err := NewUserAgentMiddleware("agent-1", "agent-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl := NewMiddlewareDownloader(NewPageDownloader(nil),
+		recordMiddleware{name: "a", calls: &calls},
+		controlMiddleware{},
+		ua,
+		recordMiddleware{name: "b", calls: &calls})
+	download := func(path string) (*basic.DownloadRespond, error) {
+		httpReq, _ := http.NewRequest("GET", server.URL+path, nil)
+		return dl.Download(basic.NewDownloadRequest(1, httpReq, 1))
+	}
+
+	for _, agent := range []string{"agent-1", "agent-2"} {
+		respond, err := download("/page")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if respond.Text() != agent {
+			t.Fatalf("Unexpected user agent %q, expected %q", respond.Text(), agent)
+		}
+	}
+	expected := []string{"request:a", "request:b", "response:b", "response:a"}
+	if len(calls) != 8 || calls[0] != expected[0] || calls[1] != expected[1] ||
+		calls[2] != expected[2] || calls[3] != expected[3] {
+		t.Fatalf("Unexpected middleware calls: %v", calls)
+	}
+
+	calls = nil
+	if _, err := download("/drop"); err != ErrDropRequest {
+		t.Fatalf("Expected ErrDropRequest, got %v", err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("The dropped request should not be processed further: %v", calls)
+	}
+	var reschedule *RescheduleError
+	if _, err := download("/later"); !errors.As(err, &reschedule) || reschedule.Delay != time.Second {
+		t.Fatalf("Expected RescheduleError, got %v", err)
+	}
+}
+
+// 在处理响应或错误时丢弃请求的中间件。
+type dropResponseMiddleware struct {
+	BaseMiddleware
+}
+
+func (dropResponseMiddleware) ProcessResponse(req *basic.DownloadRequest, respond *basic.DownloadRespond) (*basic.DownloadRespond, error) {
+	return nil, nil
+}
+
+func (dropResponseMiddleware) ProcessError(req *basic.DownloadRequest, err error) (*basic.DownloadRespond, error) {
+	return nil, nil
+}
+
+func TestMiddlewareDownloaderInnerDrop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	}))
+	defer server.Close()
+
+	var calls []string
+	dl := NewMiddlewareDownloader(NewPageDownloader(nil),
+		recordMiddleware{name: "outer", calls: &calls},
+		dropResponseMiddleware{})
+	for _, u := range []string{server.URL + "/page", "http://127.0.0.1:0/unreachable"} {
+		calls = nil
+		httpReq, _ := http.NewRequest("GET", u, nil)
+		if _, err := dl.Download(basic.NewDownloadRequest(1, httpReq, 1)); err != ErrDropRequest {
+			t.Fatalf("Expected ErrDropRequest for %s, got %v", u, err)
+		}
+		// 内层中间件丢弃请求后，外层中间件不再处理响应。
+		if len(calls) != 1 || calls[0] != "request:outer" {
+			t.Fatalf("The outer middleware should not process the dropped request of %s: %v", u, calls)
+		}
+	}
+}
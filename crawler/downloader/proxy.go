@@ -0,0 +1,67 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/proxy"
+	"errors"
+	"net/http"
+)
+
+// 视为代理异常的HTTP状态码，通常表示代理被目标站点封禁或代理自身需要认证。
+var ProxyAnomalyStatuses = map[int]struct{}{
+	http.StatusForbidden:         {},
+	http.StatusProxyAuthRequired: {},
+	http.StatusTooManyRequests:   {},
+}
+
+// 让HTTP客户端使用请求上下文中由代理池选择的代理。
+// 客户端的Transport必须为nil或*http.Transport。
+func UseProxyPool(client *http.Client, pool proxy.Pool) error {
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return errors.New("The transport of http client does not support proxy pool.")
+	}
+	transport.Proxy = pool.Proxy
+	client.Transport = transport
+	return nil
+}
+
+// 经由代理池下载的网页下载器，为每个请求选择代理并报告下载结果。
+type proxyDownloader struct {
+	PageDownloader
+	pool proxy.Pool
+}
+
+// 为网页下载器加上代理池，其HTTP客户端需已通过UseProxyPool设置。
+func NewProxyDownloader(dl PageDownloader, pool proxy.Pool) PageDownloader {
+	return &proxyDownloader{PageDownloader: dl, pool: pool}
+}
+
+func (dl *proxyDownloader) Download(req *basic.DownloadRequest) (*basic.DownloadRespond, error) {
+	httpReq := req.HttpReq()
+	if httpReq == nil {
+		return dl.PageDownloader.Download(req)
+	}
+	proxyURL, err := dl.pool.Select(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	ctx := proxy.NewContext(httpReq.Context(), proxyURL)
+	respond, err := dl.PageDownloader.Download(req.WithHttpReq(httpReq.WithContext(ctx)))
+	if err != nil {
+		// 只有网络错误与代理相关，取消的请求与下载限制等错误不影响代理的状态。
+		switch ClassifyError(err) {
+		case ERROR_CLASS_TIMEOUT, ERROR_CLASS_DNS, ERROR_CLASS_CONNECTION:
+			dl.pool.Report(proxyURL, true)
+		}
+		return nil, err
+	}
+	_, anomaly := ProxyAnomalyStatuses[respond.HttpResp().StatusCode]
+	dl.pool.Report(proxyURL, anomaly)
+	return respond, nil
+}
@@ -0,0 +1,55 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/proxy"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProxyDownloader(t *testing.T) {
+	// 作为HTTP代理的测试服务器，收到的请求带有完整的目标URL。
+	status := http.StatusOK
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "target.test" {
+			t.Errorf("Unexpected proxied url: %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(status)
+		w.Write([]byte("via proxy"))
+	}))
+	defer proxyServer.Close()
+
+	pool, err := proxy.NewPool([]string{proxyServer.URL}, proxy.STRATEGY_ROUND_ROBIN, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{}
+	if err := UseProxyPool(client, pool); err != nil {
+		t.Fatal(err)
+	}
+	dl := NewProxyDownloader(NewPageDownloader(client), pool)
+	download := func() (*basic.DownloadRespond, error) {
+		httpReq, _ := http.NewRequest("GET", "http://target.test/page", nil)
+		return dl.Download(basic.NewDownloadRequest(1, httpReq, 1))
+	}
+	respond, err := download()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if respond.Text() != "via proxy" {
+		t.Fatalf("Unexpected body: %q", respond.Text())
+	}
+	status = http.StatusForbidden
+	if _, err := download(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := download(); err != proxy.ErrNoProxy {
+		t.Fatalf("The banned proxy should be quarantined, got %v", err)
+	}
+	if stats := pool.Stats(); stats[0].Requests != 2 || stats[0].Failures != 1 {
+		t.Fatalf("Unexpected proxy stats: %+v", stats)
+	}
+}
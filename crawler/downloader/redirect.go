@@ -0,0 +1,92 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// 默认的最多重定向次数，与http.Client一致。
+const DefaultMaxRedirects = 10
+
+// 重定向的处理策略。
+type RedirectPolicy struct {
+	MaxRedirects int                    // 最多重定向的次数。
+	Follow       bool                   // 是否跟随重定向，否则直接返回重定向的响应。
+	Scope        func(u *url.URL) error // 检查重定向的目标是否在许可范围内，为nil时不检查。
+}
+
+// 检查每一次重定向，用作http.Client的CheckRedirect。
+// 超出范围或次数限制时返回类型为basic.REDIRECT_ERROR的basic.CrawlerError。
+func (policy RedirectPolicy) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if !policy.Follow {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > policy.MaxRedirects {
+		return basic.NewCrawlerError(basic.REDIRECT_ERROR,
+			fmt.Sprintf("Stopped after %d redirects. (requestUrl=%s, redirectUrl=%s)",
+				policy.MaxRedirects, via[0].URL, req.URL))
+	}
+	if policy.Scope != nil {
+		if err := policy.Scope(req.URL); err != nil {
+			return basic.NewCrawlerError(basic.REDIRECT_ERROR,
+				fmt.Sprintf("The redirect is out of scope: %s. (requestUrl=%s, redirectUrl=%s)",
+					err, via[0].URL, req.URL))
+		}
+	}
+	return nil
+}
+
+// 让HTTP客户端按策略处理重定向，客户端原有的CheckRedirect先于策略执行。
+func UseRedirectPolicy(client *http.Client, policy RedirectPolicy) {
+	previous := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if previous != nil {
+			if err := previous(req, via); err != nil {
+				return err
+			}
+		}
+		return policy.CheckRedirect(req, via)
+	}
+}
+
+// 从最终的响应回溯重定向链，按先后顺序返回。
+func redirectChain(httpResp *http.Response) []basic.Redirect {
+	var chain []basic.Redirect
+	for _, hop := range redirectResponses(httpResp) {
+		chain = append(chain, basic.Redirect{URL: hop.Request.URL, StatusCode: hop.StatusCode})
+	}
+	return chain
+}
+
+// 从最终的响应回溯到达它之前的各个重定向响应，按先后顺序返回。
+// 重定向响应的Request为得到该响应的请求，响应体已被HTTP客户端读取并关闭。
+func redirectResponses(httpResp *http.Response) []*http.Response {
+	var hops []*http.Response
+	for req := httpResp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		if req.Response.Request == nil {
+			break
+		}
+		hops = append(hops, req.Response)
+	}
+	for i, j := 0, len(hops)-1; i < j; i, j = i+1, j-1 {
+		hops[i], hops[j] = hops[j], hops[i]
+	}
+	return hops
+}
+
+// 获得重定向响应的目标URL，不是重定向或没有Location时返回nil。
+func RedirectLocation(httpResp *http.Response) *url.URL {
+	switch httpResp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil
+	}
+	location, err := httpResp.Location()
+	if err != nil {
+		return nil
+	}
+	return location
+}
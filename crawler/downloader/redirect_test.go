@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	offsite := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("offsite"))
+	}))
+	defer offsite.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, offsite.URL+"/", http.StatusFound)
+		default:
+			w.Write([]byte("final"))
+		}
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+
+	newDownloader := func(maxRedirects int, follow bool) PageDownloader {
+		client := &http.Client{}
+		UseRedirectPolicy(client, RedirectPolicy{
+			MaxRedirects: maxRedirects,
+			Follow:       follow,
+			Scope: func(u *url.URL) error {
+				if u.Host != serverUrl.Host {
+					return errors.New("offsite")
+				}
+				return nil
+			},
+		})
+		return NewPageDownloader(client)
+	}
+	download := func(dl PageDownloader, path string) (*basic.DownloadRespond, error) {
+		httpReq, _ := http.NewRequest("GET", server.URL+path, nil)
+		return dl.Download(basic.NewDownloadRequest(1, httpReq, 1))
+	}
+	isRedirectError := func(err error) bool {
+		crawlerErr, ok := err.(basic.CrawlerError)
+		return ok && crawlerErr.Type() == basic.REDIRECT_ERROR
+	}
+
+	dl := newDownloader(DefaultMaxRedirects, true)
+	respond, err := download(dl, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirects := respond.Redirects()
+	if len(redirects) != 2 || redirects[0].URL.Path != "/a" || redirects[0].StatusCode != http.StatusMovedPermanently ||
+		redirects[1].URL.Path != "/b" || redirects[1].StatusCode != http.StatusFound {
+		t.Fatalf("Unexpected redirect chain: %+v", redirects)
+	}
+	if respond.HttpResp().Request.URL.Path != "/c" || respond.Text() != "final" {
+		t.Fatalf("Unexpected final response: %s %q", respond.HttpResp().Request.URL, respond.Text())
+	}
+	if _, err := download(dl, "/away"); !isRedirectError(err) {
+		t.Fatalf("The offsite redirect should be rejected, got %v", err)
+	}
+	if _, err := download(newDownloader(1, true), "/a"); !isRedirectError(err) {
+		t.Fatalf("The redirect limit should be enforced, got %v", err)
+	}
+
+	respond, err = download(newDownloader(DefaultMaxRedirects, false), "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location := RedirectLocation(respond.HttpResp()); location == nil || location.Path != "/b" {
+		t.Fatalf("Unexpected redirect location: %v", location)
+	}
+}
@@ -0,0 +1,232 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 下载错误的类别。
+type ErrorClass string
+
+const (
+	ERROR_CLASS_TIMEOUT    ErrorClass = "timeout"    // 连接或读取超时。
+	ERROR_CLASS_DNS        ErrorClass = "dns"        // 域名解析失败。
+	ERROR_CLASS_CONNECTION ErrorClass = "connection" // 连接被拒绝、重置或意外断开。
+	ERROR_CLASS_CANCELED   ErrorClass = "canceled"   // 上下文被取消，不会重试。
+	ERROR_CLASS_OTHER      ErrorClass = "other"      // 其他错误。
+)
+
+// 判断下载错误的类别。
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.Canceled) {
+		return ERROR_CLASS_CANCELED
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsTimeout {
+			return ERROR_CLASS_TIMEOUT
+		}
+		return ERROR_CLASS_DNS
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ERROR_CLASS_TIMEOUT
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ERROR_CLASS_TIMEOUT
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ERROR_CLASS_CONNECTION
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return ERROR_CLASS_CONNECTION
+	}
+	return ERROR_CLASS_OTHER
+}
+
+// 下载重试策略的接口类型。
+type RetryPolicy interface {
+	// 根据下载的响应与错误判断请求是否需要重试，需要时返回等待的时间。
+	Retry(req *basic.DownloadRequest, resp *basic.DownloadRespond, err error) (time.Duration, bool)
+	Summary() string // 获得摘要信息。
+}
+
+// 默认重试的HTTP状态码。
+var DefaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// 默认重试的错误类别。
+var DefaultRetryErrorClasses = []ErrorClass{
+	ERROR_CLASS_TIMEOUT,
+	ERROR_CLASS_DNS,
+	ERROR_CLASS_CONNECTION,
+}
+
+// 指数退避的重试策略的实现类型。
+type retryPolicyImpl struct {
+	maxAttempts  uint32                  // 最多尝试下载的次数，包括第一次。
+	baseDelay    time.Duration           // 第一次重试的基础等待时间。
+	maxDelay     time.Duration           // 最长的等待时间，Retry-After超过它时放弃重试。
+	statuses     map[int]struct{}        // 需要重试的HTTP状态码。
+	errorClasses map[ErrorClass]struct{} // 需要重试的错误类别。
+	randLock     sync.Mutex
+	rand         *rand.Rand
+}
+
+// 创建指数退避的重试策略。maxAttempts为最多尝试下载的次数（包括第一次），
+// 第n次重试前等待baseDelay*2^(n-1)并加入随机抖动，最长不超过maxDelay。
+// 响应带有Retry-After时取其与退避时间中的较大者；Retry-After超过maxDelay时不再重试，
+// 以免早于服务端要求的时间再次请求。
+// statuses与errorClasses为需要重试的HTTP状态码与错误类别，为nil时分别使用
+// DefaultRetryStatuses与DefaultRetryErrorClasses，ERROR_CLASS_CANCELED总是不重试。
+func NewRetryPolicy(maxAttempts uint32,
+	baseDelay time.Duration,
+	maxDelay time.Duration,
+	statuses []int,
+	errorClasses []ErrorClass) (RetryPolicy, error) {
+	if maxAttempts == 0 {
+		return nil, errors.New("The max attempts of retry policy can not be 0.")
+	}
+	if baseDelay <= 0 || maxDelay < baseDelay {
+		return nil, errors.New("The retry delays are invalid.")
+	}
+	policy := &retryPolicyImpl{
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		maxDelay:    maxDelay,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if statuses == nil {
+		statuses = DefaultRetryStatuses
+	}
+	if errorClasses == nil {
+		errorClasses = DefaultRetryErrorClasses
+	}
+	policy.statuses = make(map[int]struct{}, len(statuses))
+	for _, status := range statuses {
+		policy.statuses[status] = struct{}{}
+	}
+	policy.errorClasses = make(map[ErrorClass]struct{}, len(errorClasses))
+	for _, class := range errorClasses {
+		if class != ERROR_CLASS_CANCELED {
+			policy.errorClasses[class] = struct{}{}
+		}
+	}
+	return policy, nil
+}
+
+func (policy *retryPolicyImpl) Retry(req *basic.DownloadRequest, resp *basic.DownloadRespond, err error) (time.Duration, bool) {
+	if req == nil || req.Attempt()+1 >= policy.maxAttempts {
+		return 0, false
+	}
+	var retryAfter time.Duration
+	if err != nil {
+		if _, ok := policy.errorClasses[ClassifyError(err)]; !ok {
+			return 0, false
+		}
+	} else {
+		if resp == nil || resp.HttpResp() == nil {
+			return 0, false
+		}
+		httpResp := resp.HttpResp()
+		if _, ok := policy.statuses[httpResp.StatusCode]; !ok {
+			return 0, false
+		}
+		retryAfter = parseRetryAfter(httpResp.Header.Get("Retry-After"), time.Now())
+	}
+	if retryAfter > policy.maxDelay {
+		return 0, false
+	}
+	delay := policy.backoff(req.Attempt())
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay, true
+}
+
+// 计算第attempt+1次重试的退避时间：在指数退避时间的一半到全部之间随机选取。
+func (policy *retryPolicyImpl) backoff(attempt uint32) time.Duration {
+	delay := policy.baseDelay
+	for i := uint32(0); i < attempt && delay < policy.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.maxDelay {
+		delay = policy.maxDelay
+	}
+	half := int64(delay / 2)
+	policy.randLock.Lock()
+	jitter := policy.rand.Int63n(half + 1)
+	policy.randLock.Unlock()
+	return time.Duration(half + jitter)
+}
+
+// Retry-After秒数的上限，保证换算成time.Duration时不溢出。
+const maxRetryAfterSeconds = int64(math.MaxInt64 / int64(time.Second))
+
+// 判断数字解析错误是否因超出范围引起。
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
+
+// 解析Retry-After头，支持秒数与HTTP日期两种格式，无法解析时返回0。
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil || isRangeError(err) {
+		if seconds < 0 {
+			return 0
+		}
+		// 限制秒数，避免乘法溢出成负的等待时间。
+		if seconds > maxRetryAfterSeconds {
+			seconds = maxRetryAfterSeconds
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+func (policy *retryPolicyImpl) Summary() string {
+	statuses := make([]int, 0, len(policy.statuses))
+	for status := range policy.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	classes := make([]string, 0, len(policy.errorClasses))
+	for class := range policy.errorClasses {
+		classes = append(classes, string(class))
+	}
+	sort.Strings(classes)
+	return fmt.Sprintf("maxAttempts: %d, baseDelay: %s, maxDelay: %s, statuses: %v, errorClasses: %v",
+		policy.maxAttempts, policy.baseDelay, policy.maxDelay, statuses, classes)
+}
@@ -0,0 +1,86 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	if d := parseRetryAfter("120", now); d != 2*time.Minute {
+		t.Errorf("Parse seconds got %s, expected 2m.", d)
+	}
+	date := now.Add(30 * time.Second).Format(http.TimeFormat)
+	if d := parseRetryAfter(date, now); d != 30*time.Second {
+		t.Errorf("Parse date got %s, expected 30s.", d)
+	}
+	for _, value := range []string{"9223372036854775807", "99999999999999999999"} {
+		if d := parseRetryAfter(value, now); d <= 0 {
+			t.Errorf("Parse huge seconds %s got %s, expected a positive delay.", value, d)
+		}
+	}
+	if d := parseRetryAfter("soon", now); d != 0 {
+		t.Errorf("Parse invalid value got %s, expected 0.", d)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	cases := map[ErrorClass]error{
+		ERROR_CLASS_CANCELED:   context.Canceled,
+		ERROR_CLASS_TIMEOUT:    context.DeadlineExceeded,
+		ERROR_CLASS_DNS:        &net.DNSError{Err: "no such host", Name: "a.com"},
+		ERROR_CLASS_CONNECTION: &net.OpError{Op: "dial", Err: errors.New("refused")},
+		ERROR_CLASS_OTHER:      errors.New("unknown"),
+	}
+	for class, err := range cases {
+		if got := ClassifyError(err); got != class {
+			t.Errorf("Classify %v got %s, expected %s.", err, got, class)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy, err := NewRetryPolicy(3, time.Second, 10*time.Second, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq, _ := http.NewRequest("GET", "http://a.com/", nil)
+	req := basic.NewDownloadRequest(0, httpReq, 1)
+	newResp := func(status int, retryAfter string) *basic.DownloadRespond {
+		httpResp := &http.Response{StatusCode: status, Header: http.Header{}, Request: httpReq}
+		if retryAfter != "" {
+			httpResp.Header.Set("Retry-After", retryAfter)
+		}
+		return basic.NewDownloadResponseFor(req, httpResp)
+	}
+
+	if _, ok := policy.Retry(req, newResp(http.StatusNotFound, ""), nil); ok {
+		t.Error("A 404 response should not be retried.")
+	}
+	delay, ok := policy.Retry(req, newResp(http.StatusServiceUnavailable, ""), nil)
+	if !ok || delay < 500*time.Millisecond || delay > time.Second {
+		t.Errorf("Retry 503 got (%s, %v), expected a delay between 0.5s and 1s.", delay, ok)
+	}
+	delay, ok = policy.Retry(req, newResp(http.StatusTooManyRequests, "5"), nil)
+	if !ok || delay != 5*time.Second {
+		t.Errorf("Retry 429 got (%s, %v), expected the Retry-After delay 5s.", delay, ok)
+	}
+	if _, ok := policy.Retry(req, newResp(http.StatusTooManyRequests, "60"), nil); ok {
+		t.Error("A Retry-After longer than the max delay should not be retried.")
+	}
+	if _, ok := policy.Retry(req, newResp(http.StatusTooManyRequests, "9223372036854775807"), nil); ok {
+		t.Error("A huge Retry-After should not be retried.")
+	}
+	if _, ok := policy.Retry(req, nil, context.Canceled); ok {
+		t.Error("A canceled request should not be retried.")
+	}
+	last := req.NextAttempt(time.Time{}).NextAttempt(time.Time{})
+	if _, ok := policy.Retry(last, nil, context.DeadlineExceeded); ok {
+		t.Error("The request should not be retried after the max attempts.")
+	}
+}
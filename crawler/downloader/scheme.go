@@ -0,0 +1,226 @@
+package downloader
+
+import (
+	"bytes"
+	"chaoshen.com/crawlergo/crawler/basic"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 判断协议是否由HTTP客户端下载。
+func IsHTTPScheme(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+// URL协议到网页下载器的注册表。http与https总是由各个下载器自身的HTTP客户端下载，
+// 其他协议的下载器由所有下载器共享，因此必须可以并发使用。
+type SchemeRegistry struct {
+	lock     sync.RWMutex
+	fetchers map[string]PageDownloader
+}
+
+// 创建协议注册表，内置file与data协议的下载器，其响应同样受limits限制。
+func NewSchemeRegistry(limits basic.DownloadLimitConfig) *SchemeRegistry {
+	registry := &SchemeRegistry{fetchers: map[string]PageDownloader{}}
+	registry.Register("file", NewFileDownloader(limits))
+	registry.Register("data", NewDataDownloader(limits))
+	return registry
+}
+
+// 注册协议的下载器，已注册的协议会被替换。http与https不能注册。
+func (registry *SchemeRegistry) Register(scheme string, dl PageDownloader) error {
+	scheme = strings.ToLower(scheme)
+	if scheme == "" || dl == nil {
+		return errors.New("The scheme and downloader can not be empty.")
+	}
+	if IsHTTPScheme(scheme) {
+		return fmt.Errorf("The scheme '%s' is built in.", scheme)
+	}
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.fetchers[scheme] = dl
+	return nil
+}
+
+// 获得协议的下载器，http与https以及未注册的协议返回nil。
+func (registry *SchemeRegistry) Get(scheme string) PageDownloader {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	return registry.fetchers[strings.ToLower(scheme)]
+}
+
+// 判断协议是否被支持。
+func (registry *SchemeRegistry) Supported(scheme string) bool {
+	return IsHTTPScheme(scheme) || registry.Get(scheme) != nil
+}
+
+// 获得所有支持的协议。
+func (registry *SchemeRegistry) Schemes() []string {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	schemes := []string{"http", "https"}
+	for scheme := range registry.fetchers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// 按URL协议分派请求的网页下载器。
+type schemeDownloader struct {
+	PageDownloader
+	registry *SchemeRegistry
+}
+
+// 创建按URL协议分派请求的网页下载器，http与https的请求交给httpDl下载。
+func NewSchemeDownloader(httpDl PageDownloader, registry *SchemeRegistry) PageDownloader {
+	return &schemeDownloader{PageDownloader: httpDl, registry: registry}
+}
+
+func (dl *schemeDownloader) Download(req *basic.DownloadRequest) (*basic.DownloadRespond, error) {
+	httpReq := req.HttpReq()
+	if httpReq == nil || httpReq.URL == nil || IsHTTPScheme(httpReq.URL.Scheme) {
+		return dl.PageDownloader.Download(req)
+	}
+	fetcher := dl.registry.Get(httpReq.URL.Scheme)
+	if fetcher == nil {
+		return nil, basic.NewCrawlerError(basic.SCHEME_ERROR,
+			fmt.Sprintf("The scheme '%s' is not supported. (requestUrl=%s)", httpReq.URL.Scheme, httpReq.URL))
+	}
+	return fetcher.Download(req)
+}
+
+// 创建读取本地文件的网页下载器，file URL的路径即为文件的绝对路径。
+// 文件不存在时响应状态码为404，目录不能读取。文件按limits读取，超过大小上限的部分不会读入内存。
+// 它可以读取进程有权限访问的任何文件，调度器因此总是忽略来自http与https页面的file链接。
+func NewFileDownloader(limits basic.DownloadLimitConfig) PageDownloader {
+	return NewPageDownloaderWithLimits(&http.Client{Transport: fileTransport{}}, limits)
+}
+
+// 创建解析data URL（RFC 2397）的网页下载器。
+func NewDataDownloader(limits basic.DownloadLimitConfig) PageDownloader {
+	return NewPageDownloaderWithLimits(&http.Client{Transport: dataTransport{}}, limits)
+}
+
+// 以本地文件作为响应的RoundTripper。
+type fileTransport struct{}
+
+func (fileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if host := req.URL.Host; host != "" && host != "localhost" {
+		return nil, fmt.Errorf("The file url can not have a remote host '%s'.", host)
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, fmt.Errorf("The method '%s' is not supported by file url.", req.Method)
+	}
+	path := filepath.FromSlash(req.URL.Path)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return syntheticResponse(req, http.StatusNotFound, "text/plain; charset=utf-8", []byte("file not found")), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("The file url '%s' is a directory.", req.URL)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		if contentType, err = sniffContentType(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	// 响应体由下载器像HTTP响应一样按大小上限读取，声明的长度使拒绝超限响应时无需读取文件。
+	resp := syntheticResponse(req, http.StatusOK, contentType, nil)
+	resp.ContentLength = info.Size()
+	if req.Method == http.MethodHead {
+		file.Close()
+	} else {
+		resp.Body = file
+	}
+	return resp, nil
+}
+
+// 根据文件开头的内容判断内容类型，读取后回到文件开头。
+func sniffContentType(file *os.File) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// 以data URL的内容作为响应的RoundTripper。
+type dataTransport struct{}
+
+func (dataTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// data URL没有"//"，其内容位于Opaque中。
+	raw := req.URL.Opaque
+	index := strings.Index(raw, ",")
+	if index < 0 {
+		return nil, fmt.Errorf("The data url is malformed. (requestUrl=%s)", req.URL)
+	}
+	mediaType, encoded := raw[:index], raw[index+1:]
+	isBase64 := false
+	if strings.HasSuffix(strings.ToLower(mediaType), ";base64") {
+		isBase64 = true
+		mediaType = mediaType[:len(mediaType)-len(";base64")]
+	}
+	data, err := url.PathUnescape(encoded)
+	if err != nil {
+		return nil, err
+	}
+	body := []byte(data)
+	if isBase64 {
+		if body, err = base64.StdEncoding.DecodeString(data); err != nil {
+			return nil, err
+		}
+	}
+	if mediaType == "" {
+		mediaType = "text/plain;charset=US-ASCII"
+	} else if strings.HasPrefix(mediaType, ";") {
+		mediaType = "text/plain" + mediaType
+	}
+	return syntheticResponse(req, http.StatusOK, mediaType, body), nil
+}
+
+// 创建本地生成的HTTP响应。
+func syntheticResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		Request:       req,
+	}
+	if req.Method == http.MethodHead {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	return resp
+}
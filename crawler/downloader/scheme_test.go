@@ -0,0 +1,110 @@
+package downloader
+
+import (
+	"bytes"
+	"chaoshen.com/crawlergo/crawler/basic"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSchemeDownloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scheme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	page := filepath.Join(dir, "page.html")
+	if err := ioutil.WriteFile(page, []byte("<html>local</html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	limits := basic.NewDownloadLimitConfig(basic.DefaultMaxBodySize, basic.OVERSIZE_TRUNCATE)
+	registry := NewSchemeRegistry(limits)
+	if !registry.Supported("file") || !registry.Supported("data") {
+		t.Fatalf("The file and data schemes should be registered by default, got %v", registry.Schemes())
+	}
+	dl := NewSchemeDownloader(NewPageDownloader(nil), registry)
+	download := func(rawUrl string) (*basic.DownloadRespond, error) {
+		httpReq, err := http.NewRequest("GET", rawUrl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dl.Download(basic.NewDownloadRequest(1, httpReq, 1))
+	}
+
+	fileUrl := (&url.URL{Scheme: "file", Path: filepath.ToSlash(page)}).String()
+	respond, err := download(fileUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if respond.HttpResp().StatusCode != http.StatusOK || respond.Text() != "<html>local</html>" {
+		t.Fatalf("Unexpected file response: %d %q", respond.HttpResp().StatusCode, respond.Text())
+	}
+	if respond, err := download(fileUrl + ".missing"); err != nil || respond.HttpResp().StatusCode != http.StatusNotFound {
+		t.Fatalf("The missing file should get 404, got %v", err)
+	}
+
+	cases := map[string]string{
+		"data:,A%20brief%20note":                          "A brief note",
+		"data:text/html;base64,PHA+aGk8L3A+":              "<p>hi</p>",
+		"data:text/html;charset=utf-8,%E4%BD%A0%E5%A5%BD": "你好",
+	}
+	for rawUrl, expected := range cases {
+		respond, err := download(rawUrl)
+		if err != nil {
+			t.Fatalf("Download %s error: %s", rawUrl, err)
+		}
+		if respond.Text() != expected {
+			t.Errorf("Unexpected text of %s: %q", rawUrl, respond.Text())
+		}
+	}
+
+	_, err = download("ftp://example.com/file")
+	if crawlerErr, ok := err.(basic.CrawlerError); !ok || crawlerErr.Type() != basic.SCHEME_ERROR {
+		t.Fatalf("Expected scheme error, got %v", err)
+	}
+	if !registry.Supported("FILE") || registry.Supported("ftp") || registry.Register("http", dl) == nil {
+		t.Error("Unexpected scheme registry behavior.")
+	}
+}
+
+func TestFileDownloaderLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scheme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	page := filepath.Join(dir, "large.txt")
+	if err := ioutil.WriteFile(page, bytes.Repeat([]byte("a"), 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileUrl := (&url.URL{Scheme: "file", Path: filepath.ToSlash(page)}).String()
+	download := func(action basic.OversizeAction) (*basic.DownloadRespond, error) {
+		httpReq, err := http.NewRequest("GET", fileUrl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dl := NewFileDownloader(basic.NewDownloadLimitConfig(10, action))
+		return dl.Download(basic.NewDownloadRequest(1, httpReq, 1))
+	}
+
+	respond, err := download(basic.OVERSIZE_TRUNCATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !respond.Truncated() || len(respond.Body()) != 10 {
+		t.Fatalf("The file should be truncated to 10 bytes, got %d bytes (truncated=%v)",
+			len(respond.Body()), respond.Truncated())
+	}
+	if respond.HttpResp().Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("Unexpected content type %q", respond.HttpResp().Header.Get("Content-Type"))
+	}
+
+	_, err = download(basic.OVERSIZE_REJECT)
+	if crawlerErr, ok := err.(basic.CrawlerError); !ok || crawlerErr.Type() != basic.RESPONSE_TOO_LARGE_ERROR {
+		t.Fatalf("Expected response too large error, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// 记录一次下载的网络耗时。
+type timingRecorder struct {
+	lock         sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	timing       basic.NetworkTiming
+}
+
+func newTimingRecorder() *timingRecorder {
+	return &timingRecorder{start: time.Now()}
+}
+
+// 为请求加上记录耗时的httptrace。
+func (recorder *timingRecorder) trace(httpReq *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			recorder.lock.Lock()
+			recorder.dnsStart = time.Now()
+			recorder.lock.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			recorder.lock.Lock()
+			if !recorder.dnsStart.IsZero() {
+				recorder.timing.DNS += time.Since(recorder.dnsStart)
+			}
+			recorder.lock.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			recorder.lock.Lock()
+			// 同时尝试多个地址时，只记录第一次开始的时间。
+			if recorder.connectStart.IsZero() {
+				recorder.connectStart = time.Now()
+			}
+			recorder.lock.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			recorder.lock.Lock()
+			if err == nil && !recorder.connectStart.IsZero() {
+				recorder.timing.Connect += time.Since(recorder.connectStart)
+				recorder.connectStart = time.Time{}
+			}
+			recorder.lock.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			recorder.lock.Lock()
+			recorder.tlsStart = time.Now()
+			recorder.lock.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			recorder.lock.Lock()
+			if !recorder.tlsStart.IsZero() {
+				recorder.timing.TLSHandshake += time.Since(recorder.tlsStart)
+			}
+			recorder.lock.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			recorder.lock.Lock()
+			recorder.timing.ConnReused = info.Reused
+			recorder.lock.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			recorder.lock.Lock()
+			recorder.timing.FirstByte = time.Since(recorder.start)
+			recorder.lock.Unlock()
+		},
+	}
+	return httpReq.WithContext(httptrace.WithClientTrace(httpReq.Context(), trace))
+}
+
+// 结束记录，返回包括读取响应体在内的耗时。
+func (recorder *timingRecorder) finish() basic.NetworkTiming {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	timing := recorder.timing
+	timing.Total = time.Since(recorder.start)
+	return timing
+}
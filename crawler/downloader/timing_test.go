@@ -0,0 +1,38 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloadTiming(t *testing.T) {
+	delay := 20 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Write([]byte("slow"))
+	}))
+	defer server.Close()
+
+	dl := NewPageDownloader(nil)
+	download := func() basic.NetworkTiming {
+		httpReq, _ := http.NewRequest("GET", server.URL, nil)
+		respond, err := dl.Download(basic.NewDownloadRequest(1, httpReq, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return respond.Timing()
+	}
+	first := download()
+	if first.ConnReused || first.Connect <= 0 {
+		t.Errorf("The first request should open a new connection: %+v", first)
+	}
+	if first.FirstByte < delay || first.Total < first.FirstByte {
+		t.Errorf("Unexpected timing: %+v", first)
+	}
+	if second := download(); !second.ConnReused || second.Connect != 0 {
+		t.Errorf("The second request should reuse the connection: %+v", second)
+	}
+}
@@ -0,0 +1,119 @@
+package downloader
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/warc"
+	"errors"
+	"github.com/astaxie/beego/logs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 将下载的请求与响应写入WARC文件的中间件。
+type warcMiddleware struct {
+	BaseMiddleware
+	writer warc.Writer
+}
+
+// 创建将HTTP请求与响应写入WARC文件的中间件。发生重定向时，每一次重定向的请求与响应
+// 也按先后顺序写入，其响应体已被HTTP客户端丢弃，记录中只有状态行与响应头。
+// 记录的是HTTP客户端处理后的响应：响应体已被解压，响应头不含Content-Encoding，
+// Content-Length为记录的响应体的长度，因此与网络上传输的字节并不相同。
+// 因大小或内容类型被拒绝的响应同样写入，只带有拒绝前读取的响应体，并以warc.FIELD_REJECTED标明；
+// 下载失败而没有响应的请求写入请求记录与记录失败原因的metadata记录。
+// 非http协议的请求以及HTTP缓存中未修改的响应不会被写入，写入失败不影响下载。
+func NewWARCMiddleware(writer warc.Writer) Middleware {
+	return &warcMiddleware{writer: writer}
+}
+
+func (mw *warcMiddleware) ProcessResponse(req *basic.DownloadRequest, respond *basic.DownloadRespond) (*basic.DownloadRespond, error) {
+	httpResp := respond.HttpResp()
+	if httpResp == nil || respond.NotModified() {
+		return respond, nil
+	}
+	records := exchangeRecords(req, httpResp, respond.Body(), respond.Truncated(), time.Now())
+	mw.write(req, records)
+	return respond, nil
+}
+
+func (mw *warcMiddleware) ProcessError(req *basic.DownloadRequest, err error) (*basic.DownloadRespond, error) {
+	httpReq := req.HttpReq()
+	if httpReq == nil || httpReq.URL == nil || !IsHTTPScheme(httpReq.URL.Scheme) {
+		return nil, err
+	}
+	now := time.Now()
+	var rejected *RejectedError
+	if errors.As(err, &rejected) && rejected.Response != nil {
+		// 读取了超出上限的响应体时截断于上限，否则响应体未被读取。
+		truncated := "unspecified"
+		if len(rejected.Body) > 0 {
+			truncated = "length"
+		}
+		records := exchangeRecords(req, rejected.Response, rejected.Body, false, now)
+		if len(records) > 0 {
+			// 最后一对记录中的响应记录即被拒绝的响应。
+			final := records[len(records)-2]
+			final.Fields = append(final.Fields,
+				warc.Field{Name: "WARC-Truncated", Value: truncated},
+				warc.Field{Name: warc.FIELD_REJECTED, Value: string(rejected.Type())})
+		}
+		mw.write(req, records)
+		return nil, err
+	}
+	reqRecord := warc.NewRequestRecord(httpReq, requestBody(req.Spec(), httpReq), now)
+	reqRecord.ID = warc.NewRecordID()
+	metaRecord := warc.NewMetadataRecord(httpReq.URL.String(),
+		[]warc.Field{{Name: "fetch-error", Value: strings.TrimSpace(err.Error())}}, now)
+	metaRecord.Fields = append(metaRecord.Fields, warc.Field{Name: "WARC-Concurrent-To", Value: reqRecord.ID})
+	mw.write(req, []*warc.Record{reqRecord, metaRecord})
+	return nil, err
+}
+
+func (mw *warcMiddleware) write(req *basic.DownloadRequest, records []*warc.Record) {
+	if len(records) == 0 {
+		return
+	}
+	if err := mw.writer.WriteRecords(records...); err != nil {
+		logs.Warning("Write the warc records error: %s. (requestUrl=%s)", err, req.HttpReq().URL)
+	}
+}
+
+// 创建一次下载的全部记录，包括之前每一次重定向的记录对，最后一对为最终的响应与请求。
+// 非http协议的请求返回nil。
+func exchangeRecords(req *basic.DownloadRequest, httpResp *http.Response,
+	body []byte, truncated bool, date time.Time) []*warc.Record {
+	// 发生重定向时，响应对应的是最后一次请求。
+	httpReq := httpResp.Request
+	if httpReq == nil {
+		httpReq = req.HttpReq()
+	}
+	if httpReq == nil || httpReq.URL == nil || !IsHTTPScheme(httpReq.URL.Scheme) {
+		return nil
+	}
+	records := make([]*warc.Record, 0, 2)
+	for _, hop := range redirectResponses(httpResp) {
+		records = append(records, recordPair(req.Spec(), hop.Request, hop, nil, false, date)...)
+	}
+	return append(records, recordPair(req.Spec(), httpReq, httpResp, body, truncated, date)...)
+}
+
+// 创建一对响应记录与请求记录，请求记录通过WARC-Concurrent-To关联到响应记录。
+func recordPair(spec *basic.RequestSpec, httpReq *http.Request, httpResp *http.Response,
+	body []byte, truncated bool, date time.Time) []*warc.Record {
+	respRecord := warc.NewResponseRecord(httpResp, body, truncated, date)
+	respRecord.ID = warc.NewRecordID()
+	reqRecord := warc.NewRequestRecord(httpReq, requestBody(spec, httpReq), date)
+	reqRecord.Fields = append(reqRecord.Fields, warc.Field{Name: "WARC-Concurrent-To", Value: respRecord.ID})
+	return []*warc.Record{respRecord, reqRecord}
+}
+
+// 获得实际发送的请求体。重定向后请求方法不变且带有请求体时（307与308），
+// 发送的仍是请求描述中的请求体，否则没有请求体。
+func requestBody(spec *basic.RequestSpec, httpReq *http.Request) []byte {
+	if spec == nil || len(spec.Body) == 0 || httpReq.ContentLength == 0 ||
+		!strings.EqualFold(httpReq.Method, spec.Method) {
+		return nil
+	}
+	return spec.Body
+}
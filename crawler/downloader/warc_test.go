@@ -0,0 +1,210 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/warc"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 测试中解析的WARC记录。
+type testRecord struct {
+	fields map[string]string
+	block  string
+}
+
+// 读取WARC文件中的全部记录，每条记录是单独的gzip成员。
+func readTestRecords(t *testing.T, path string) []testRecord {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	buffered := bufio.NewReader(file)
+	reader, err := gzip.NewReader(buffered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []testRecord
+	for {
+		reader.Multistream(false)
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, reader); err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.SplitN(strings.TrimSuffix(buf.String(), "\r\n\r\n"), "\r\n\r\n", 2)
+		rec := testRecord{fields: map[string]string{}}
+		for _, line := range strings.Split(parts[0], "\r\n")[1:] {
+			if i := strings.Index(line, ": "); i > 0 {
+				rec.fields[line[:i]] = line[i+2:]
+			}
+		}
+		if len(parts) == 2 {
+			rec.block = parts[1]
+		}
+		records = append(records, rec)
+		if err := reader.Reset(buffered); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return records
+}
+
+func TestWARCMiddlewareRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/start":
+			http.Redirect(w, r, "/middle", http.StatusTemporaryRedirect)
+		case "/middle":
+			http.Redirect(w, r, "/end", http.StatusFound)
+		default:
+			w.Write([]byte("end"))
+		}
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writer, err := warc.NewWriter(dir, "crawl", 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl := NewMiddlewareDownloader(NewPageDownloader(nil), NewWARCMiddleware(writer))
+	httpReq, _ := http.NewRequest("POST", server.URL+"/start", strings.NewReader("q=go"))
+	if _, err := dl.Download(basic.NewDownloadRequest(1, httpReq, 1)); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 warc file, got %d", len(files))
+	}
+	var responses, requests []testRecord
+	for _, rec := range readTestRecords(t, files[0]) {
+		switch rec.fields["WARC-Type"] {
+		case "response":
+			responses = append(responses, rec)
+		case "request":
+			requests = append(requests, rec)
+		}
+	}
+	expected := []struct {
+		path   string
+		status string
+		block  string
+	}{
+		{"/start", "307", "POST /start HTTP/1.1"},
+		{"/middle", "302", "POST /middle HTTP/1.1"},
+		{"/end", "200", "GET /end HTTP/1.1"},
+	}
+	if len(responses) != len(expected) || len(requests) != len(expected) {
+		t.Fatalf("Expected %d record pairs, got %d responses and %d requests",
+			len(expected), len(responses), len(requests))
+	}
+	for i, e := range expected {
+		if responses[i].fields["WARC-Target-URI"] != server.URL+e.path ||
+			!strings.HasPrefix(responses[i].block, "HTTP/1.1 "+e.status) {
+			t.Errorf("Unexpected response record %d: %v %q", i, responses[i].fields, responses[i].block)
+		}
+		if requests[i].fields["WARC-Concurrent-To"] != responses[i].fields["WARC-Record-ID"] ||
+			!strings.HasPrefix(requests[i].block, e.block) {
+			t.Errorf("Unexpected request record %d: %q", i, requests[i].block)
+		}
+	}
+	// 307保持请求体，302之后改为不带请求体的GET请求。
+	if !strings.HasSuffix(requests[1].block, "\r\n\r\nq=go") || strings.HasSuffix(requests[2].block, "q=go") {
+		t.Errorf("Unexpected request bodies: %q %q", requests[1].block, requests[2].block)
+	}
+}
+
+func TestWARCMiddlewareRejectedAndFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			// 分块传输，没有声明长度，超过上限时已读取了部分响应体。
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(bytes.Repeat([]byte("a"), 50))
+			w.(http.Flusher).Flush()
+			w.Write(bytes.Repeat([]byte("a"), 50))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		}
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writer, err := warc.NewWriter(dir, "crawl", 1<<20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := basic.NewDownloadLimitConfig(10, basic.OVERSIZE_REJECT, "text/")
+	dl := NewMiddlewareDownloader(NewPageDownloaderWithLimits(&http.Client{}, limits), NewWARCMiddleware(writer))
+	for _, rawUrl := range []string{server.URL + "/large", server.URL + "/image", "http://127.0.0.1:1/refused"} {
+		httpReq, _ := http.NewRequest("GET", rawUrl, nil)
+		if _, err := dl.Download(basic.NewDownloadRequest(1, httpReq, 1)); err == nil {
+			t.Fatalf("The download of %s should fail.", rawUrl)
+		}
+	}
+	writer.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	records := readTestRecords(t, files[0])
+	byTarget := map[string]map[string]testRecord{}
+	for _, rec := range records {
+		target := rec.fields["WARC-Target-URI"]
+		if byTarget[target] == nil {
+			byTarget[target] = map[string]testRecord{}
+		}
+		byTarget[target][rec.fields["WARC-Type"]] = rec
+	}
+	large := byTarget[server.URL+"/large"]
+	if rec := large["response"]; rec.fields["WARC-Truncated"] != "length" ||
+		rec.fields[warc.FIELD_REJECTED] != string(basic.RESPONSE_TOO_LARGE_ERROR) ||
+		!strings.HasSuffix(rec.block, "\r\n\r\n"+strings.Repeat("a", 10)) {
+		t.Errorf("Unexpected rejected large response record: %v %q", rec.fields, rec.block)
+	}
+	image := byTarget[server.URL+"/image"]
+	if rec := image["response"]; rec.fields["WARC-Truncated"] != "unspecified" ||
+		rec.fields[warc.FIELD_REJECTED] != string(basic.CONTENT_TYPE_ERROR) ||
+		!strings.Contains(rec.block, "Content-Type: image/png") {
+		t.Errorf("Unexpected rejected image response record: %v %q", rec.fields, rec.block)
+	}
+	if _, ok := image["request"]; !ok {
+		t.Error("The request of the rejected response should be recorded.")
+	}
+	refused := byTarget["http://127.0.0.1:1/refused"]
+	request, meta := refused["request"], refused["metadata"]
+	if request.fields["WARC-Record-ID"] == "" || meta.fields["WARC-Concurrent-To"] != request.fields["WARC-Record-ID"] ||
+		!strings.HasPrefix(meta.block, "fetch-error: ") {
+		t.Errorf("Unexpected records of the failed request: %v %v %q", request.fields, meta.fields, meta.block)
+	}
+
+	// 被拒绝的响应不用于回放。
+	store, err := NewWARCStore(nil, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq, _ := http.NewRequest("GET", server.URL+"/large", nil)
+	_, err = NewReplayDownloader(store, nil).Download(basic.NewDownloadRequest(1, httpReq, 1))
+	if crawlerErr, ok := err.(basic.CrawlerError); !ok || crawlerErr.Type() != basic.ARCHIVE_MISS_ERROR {
+		t.Fatalf("Expected archive miss error for the rejected response, got %v", err)
+	}
+}
@@ -1,21 +1,25 @@
 package pageParser
 
 import (
+	"context"
 	"chaoshen.com/crawlergo/crawler/basic"
 	"chaoshen.com/crawlergo/crawler/util"
-	"net/http"
 	"errors"
 	"github.com/astaxie/beego/logs"
 	"fmt"
 )
 
-type ParseResponse func(httpResp *http.Response, respDepth uint32) ([]basic.BaseData, []error)
+// 响应分析函数，ctx被取消时应尽快返回。
+// 每个分析函数得到各自的响应副本，可通过respond.Text()获得转换为UTF-8的文本，
+// 通过respond.Body()获得原始响应体，也可以读取并关闭respond.HttpResp().Body（UTF-8文本）
+// 而不影响其他分析函数。
+type ParseResponse func(ctx context.Context, respond *basic.DownloadRespond) ([]basic.BaseData, []error)
 
 var idGenerator = util.NewIdGenerator()
 
 type PageParser interface {
 	Id() uint32
-	ParsePage(respParsers []ParseResponse, respond *basic.DownloadRespond) ([]basic.BaseData, []error)
+	ParsePage(ctx context.Context, respParsers []ParseResponse, respond *basic.DownloadRespond) ([]basic.BaseData, []error)
 }
 
 type PageParserImpl struct {
@@ -30,6 +34,7 @@ func (ppi *PageParserImpl) Id() uint32 {
 	return ppi.id
 }
 func (ppi *PageParserImpl) ParsePage(
+	ctx context.Context,
 	respParsers []ParseResponse,
 	respond *basic.DownloadRespond) ([]basic.BaseData, []error) {
 	if respond == nil {
@@ -45,20 +50,23 @@ func (ppi *PageParserImpl) ParsePage(
 	reqUrl:=httpResp.Request.URL
 	logs.Info("Begin parse the response (reqUrl=%s)... \n", reqUrl)
 
-	reqDepth:=respond.Depth()
-
 	dataList:=make([]basic.BaseData,0)
 	errorList:=make([]error,0)
 
 
 	for i,respParser:=range respParsers{
+		if err:=ctx.Err();err!=nil {
+			errorList=append(errorList,err)
+			break
+		}
 		if respParser==nil {
 			err:=errors.New(fmt.Sprintf("The document parser [%d] is invalid!",i))
 			errorList=append(errorList,err)
+			continue
 		}
-		pDataList,pErrorList:=respParser(httpResp,reqDepth)
+		pDataList,pErrorList:=respParser(ctx,respond.Clone())
 		for _,data:=range pDataList {
-			dataList=appendDataList(dataList,data,reqDepth)
+			dataList=appendDataList(dataList,data,respond)
 		}
 
 		for _,err:= range pErrorList{
@@ -68,17 +76,22 @@ func (ppi *PageParserImpl) ParsePage(
 	return dataList,errorList
 }
 
-func appendDataList(dataList []basic.BaseData,data basic.BaseData,depth uint32) []basic.BaseData{
+func appendDataList(dataList []basic.BaseData,data basic.BaseData,respond *basic.DownloadRespond) []basic.BaseData{
 	if data==nil {
 		return dataList
 	}
 	req,ok:=data.(*basic.DownloadRequest)
 	if !ok{
+		if item,ok:=data.(basic.ItemMap);ok && item!=nil && respond.NotModified() {
+			item[basic.ITEM_NOT_MODIFIED_KEY]=true
+		}
 		return append(dataList,data)
 	}
+	depth:=respond.Depth()
 	if req.Depth()!=depth+1 {
-		req=basic.NewDownloadRequest(req.GetID(),req.HttpReq(),depth+1)
+		req=req.WithDepth(depth+1)
 	}
+	req.SetParentScore(respond.Score())
 	return append(dataList,req)
 }
 
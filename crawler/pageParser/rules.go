@@ -0,0 +1,252 @@
+package pageParser
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 规则解析器产生的条目中记录条目类型与页面URL的键。
+const (
+	ITEM_TYPE_KEY = "_type"
+	ITEM_URL_KEY  = "_url"
+)
+
+// 字段的类型。
+const (
+	FIELD_STRING = "string"
+	FIELD_INT    = "int"
+	FIELD_FLOAT  = "float"
+	FIELD_BOOL   = "bool"
+)
+
+// 一组抽取规则，通常由YAML文件加载。
+type ExtractRules struct {
+	Rules []*ExtractRule `yaml:"rules"`
+}
+
+// 一条抽取规则：URL与Pattern匹配的页面按Fields抽取出类型为Type的条目。
+type ExtractRule struct {
+	Name    string       `yaml:"name"`
+	Pattern string       `yaml:"pattern"` // 页面URL的正则表达式。
+	Type    string       `yaml:"type"`    // 条目类型，记录在条目的ITEM_TYPE_KEY中。
+	Scope   string       `yaml:"scope"`   // 条目的CSS选择器，每个匹配的元素产生一个条目，为空时整个页面产生一个条目。
+	Fields  []*FieldRule `yaml:"fields"`
+	regexp  *regexp.Regexp
+}
+
+// 条目中一个字段的抽取规则。
+type FieldRule struct {
+	Name     string `yaml:"name"`
+	Selector string `yaml:"selector"` // 相对于条目的CSS选择器，为空时使用条目元素本身。
+	Attr     string `yaml:"attr"`     // 取值的属性，为空时取元素的文本。
+	Regex    string `yaml:"regex"`    // 对取得的值再做匹配，有分组时取第一个分组。
+	Type     string `yaml:"type"`     // 值的类型，为空时为string。
+	Required bool   `yaml:"required"` // 必需的字段缺失时丢弃整个条目。
+	Multiple bool   `yaml:"multiple"` // 是否取所有匹配元素的值，结果为切片。
+	regexp   *regexp.Regexp
+}
+
+// 从YAML文件加载抽取规则。
+func LoadRules(path string) (*ExtractRules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data)
+}
+
+// 解析YAML格式的抽取规则并检查其合法性。
+func ParseRules(data []byte) (*ExtractRules, error) {
+	rules := &ExtractRules{}
+	if err := yaml.Unmarshal(data, rules); err != nil {
+		return nil, err
+	}
+	if len(rules.Rules) == 0 {
+		return nil, errors.New("The extract rules can not be empty.")
+	}
+	for i, rule := range rules.Rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("The extract rule [%d] is illegal: %s", i, err)
+		}
+	}
+	return rules, nil
+}
+
+// 检查规则并编译其中的正则表达式。
+func (rule *ExtractRule) compile() error {
+	if rule.Pattern == "" || rule.Type == "" {
+		return errors.New("The pattern and type can not be empty.")
+	}
+	if len(rule.Fields) == 0 {
+		return errors.New("The fields can not be empty.")
+	}
+	var err error
+	if rule.regexp, err = regexp.Compile(rule.Pattern); err != nil {
+		return err
+	}
+	for _, field := range rule.Fields {
+		if field.Name == "" {
+			return errors.New("The field name can not be empty.")
+		}
+		switch field.Type {
+		case "":
+			field.Type = FIELD_STRING
+		case FIELD_STRING, FIELD_INT, FIELD_FLOAT, FIELD_BOOL:
+		default:
+			return fmt.Errorf("Unknown type of field %s: %s", field.Name, field.Type)
+		}
+		if field.Regex != "" {
+			if field.regexp, err = regexp.Compile(field.Regex); err != nil {
+				return fmt.Errorf("Illegal regex of field %s: %s", field.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 规则是否适用于该URL。
+func (rule *ExtractRule) Match(rawUrl string) bool {
+	return rule.regexp != nil && rule.regexp.MatchString(rawUrl)
+}
+
+// 根据抽取规则创建响应分析函数。页面URL匹配的每条规则都参与抽取，
+// 得到的条目为basic.ItemMap，除字段外还带有ITEM_TYPE_KEY与ITEM_URL_KEY。
+// 缺少必需字段或类型转换失败的条目被丢弃，并返回PAGEPARSER_ERROR类型的错误。
+func NewRuleParser(rules *ExtractRules) ParseResponse {
+	return func(ctx context.Context, respond *basic.DownloadRespond) ([]basic.BaseData, []error) {
+		httpResp := respond.HttpResp()
+		if httpResp == nil || httpResp.Request == nil || httpResp.Request.URL == nil {
+			return nil, []error{errors.New("The http response is invalid.")}
+		}
+		reqUrl := httpResp.Request.URL.String()
+		matched := make([]*ExtractRule, 0)
+		for _, rule := range rules.Rules {
+			if rule.Match(reqUrl) {
+				matched = append(matched, rule)
+			}
+		}
+		if len(matched) == 0 {
+			return nil, nil
+		}
+		doc, err := goquery.NewDocumentFromReader(respond.TextReader())
+		if err != nil {
+			return nil, []error{err}
+		}
+		dataList := make([]basic.BaseData, 0)
+		errorList := make([]error, 0)
+		for _, rule := range matched {
+			if err := ctx.Err(); err != nil {
+				errorList = append(errorList, err)
+				break
+			}
+			scopes := doc.Selection
+			if rule.Scope != "" {
+				scopes = doc.Find(rule.Scope)
+			}
+			scopes.Each(func(index int, sel *goquery.Selection) {
+				item, err := rule.extract(sel)
+				if err != nil {
+					errorList = append(errorList, basic.NewCrawlerError(basic.PAGEPARSER_ERROR,
+						fmt.Sprintf("%s (rule=%s, index=%d, url=%s)", err, rule.Name, index, reqUrl)))
+					return
+				}
+				item[ITEM_URL_KEY] = reqUrl
+				dataList = append(dataList, item)
+			})
+		}
+		return dataList, errorList
+	}
+}
+
+// 从条目元素中抽取各字段。
+func (rule *ExtractRule) extract(sel *goquery.Selection) (basic.ItemMap, error) {
+	item := basic.ItemMap{ITEM_TYPE_KEY: rule.Type}
+	for _, field := range rule.Fields {
+		values, err := field.extract(sel)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			if field.Required {
+				return nil, fmt.Errorf("The required field %s is missing.", field.Name)
+			}
+			continue
+		}
+		if field.Multiple {
+			item[field.Name] = values
+		} else {
+			item[field.Name] = values[0]
+		}
+	}
+	return item, nil
+}
+
+// 抽取字段的值，Multiple为false时最多返回一个值，空值被忽略。
+func (field *FieldRule) extract(sel *goquery.Selection) ([]interface{}, error) {
+	targets := sel
+	if field.Selector != "" {
+		targets = sel.Find(field.Selector)
+	}
+	values := make([]interface{}, 0)
+	for i := range targets.Nodes {
+		target := targets.Eq(i)
+		var raw string
+		if field.Attr == "" {
+			raw = target.Text()
+		} else {
+			raw, _ = target.Attr(field.Attr)
+		}
+		raw = strings.TrimSpace(raw)
+		if field.regexp != nil {
+			match := field.regexp.FindStringSubmatch(raw)
+			switch {
+			case match == nil:
+				raw = ""
+			case len(match) > 1:
+				raw = strings.TrimSpace(match[1])
+			default:
+				raw = match[0]
+			}
+		}
+		if raw == "" {
+			continue
+		}
+		value, err := field.convert(raw)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if !field.Multiple {
+			break
+		}
+	}
+	return values, nil
+}
+
+// 将值转换为字段的类型。
+func (field *FieldRule) convert(raw string) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch field.Type {
+	case FIELD_INT:
+		value, err = strconv.ParseInt(strings.Replace(raw, ",", "", -1), 10, 64)
+	case FIELD_FLOAT:
+		value, err = strconv.ParseFloat(strings.Replace(raw, ",", "", -1), 64)
+	case FIELD_BOOL:
+		value, err = strconv.ParseBool(raw)
+	default:
+		value = raw
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Convert field %s to %s error: %q", field.Name, field.Type, raw)
+	}
+	return value, nil
+}
@@ -0,0 +1,110 @@
+package pageParser
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"context"
+	"net/http"
+	"testing"
+)
+
+const testRules = `
+rules:
+  - name: product
+    pattern: ^https?://shop\.example\.com/list
+    type: product
+    scope: div.product
+    fields:
+      - name: title
+        selector: h2
+        required: true
+      - name: link
+        selector: a
+        attr: href
+      - name: price
+        selector: .price
+        regex: '([0-9.,]+)'
+        type: float
+        required: true
+      - name: stock
+        selector: .stock
+        type: int
+      - name: tags
+        selector: .tag
+        multiple: true
+  - name: page
+    pattern: ^https?://shop\.example\.com/
+    type: page
+    fields:
+      - name: title
+        selector: title
+`
+
+const testPage = `<html><head><title> Shop </title></head><body>
+<div class="product"><h2>Apple</h2><a href="/apple">more</a><span class="price">$1,200.50</span>
+<span class="stock">7</span><span class="tag">fruit</span><span class="tag">red</span></div>
+<div class="product"><h2>Pear</h2><span class="price">$3</span></div>
+<div class="product"><h2>Broken</h2></div>
+</body></html>`
+
+func newTestRespond(t *testing.T, rawUrl string, page string) *basic.DownloadRespond {
+	httpReq, err := http.NewRequest("GET", rawUrl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respond := basic.NewDownloadResponse(0, &http.Response{StatusCode: 200, Request: httpReq}, 0)
+	respond.SetBody([]byte(page), false)
+	return respond
+}
+
+func TestRuleParser(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser := NewRuleParser(rules)
+	dataList, errorList := parser(context.Background(), newTestRespond(t, "http://shop.example.com/list?page=1", testPage))
+	if len(errorList) != 1 {
+		t.Fatalf("Expected 1 error for the item missing price, got %v", errorList)
+	}
+	if len(dataList) != 3 {
+		t.Fatalf("Expected 2 products and 1 page, got %d items", len(dataList))
+	}
+	apple := dataList[0].(basic.ItemMap)
+	if apple[ITEM_TYPE_KEY] != "product" || apple["title"] != "Apple" || apple["link"] != "/apple" {
+		t.Fatalf("Unexpected item: %v", apple)
+	}
+	if apple["price"] != 1200.5 || apple["stock"] != int64(7) {
+		t.Fatalf("Unexpected converted fields: %v", apple)
+	}
+	if tags, ok := apple["tags"].([]interface{}); !ok || len(tags) != 2 || tags[1] != "red" {
+		t.Fatalf("Unexpected tags: %v", apple["tags"])
+	}
+	pear := dataList[1].(basic.ItemMap)
+	if _, ok := pear["stock"]; ok || pear["price"] != float64(3) {
+		t.Fatalf("Unexpected item: %v", pear)
+	}
+	page := dataList[2].(basic.ItemMap)
+	if page[ITEM_TYPE_KEY] != "page" || page["title"] != "Shop" || page[ITEM_URL_KEY] != "http://shop.example.com/list?page=1" {
+		t.Fatalf("Unexpected page item: %v", page)
+	}
+
+	dataList, errorList = parser(context.Background(), newTestRespond(t, "http://other.example.com/", testPage))
+	if len(dataList) != 0 || len(errorList) != 0 {
+		t.Fatalf("Expected no items for an unmatched url, got %v %v", dataList, errorList)
+	}
+}
+
+func TestParseRulesInvalid(t *testing.T) {
+	invalid := []string{
+		``,
+		"rules:\n  - pattern: x\n    fields:\n      - name: a\n",
+		"rules:\n  - pattern: '('\n    type: t\n    fields:\n      - name: a\n",
+		"rules:\n  - pattern: x\n    type: t\n    fields:\n      - name: a\n        type: date\n",
+		"rules:\n  - pattern: x\n    type: t\n",
+	}
+	for _, data := range invalid {
+		if _, err := ParseRules([]byte(data)); err == nil {
+			t.Errorf("Expected error for rules: %q", data)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package itemproc
 
 import (
+	"context"
 	"chaoshen.com/crawlergo/crawler/basic"
 	"qiniupkg.com/x/errors.v7"
 	"fmt"
@@ -8,7 +9,7 @@ import (
 )
 
 type ItemPipeline interface {
-	Send(itemsMap basic.ItemMap) []error
+	Send(ctx context.Context, itemsMap basic.ItemMap) []error
 	FastFail() bool
 	SetFastFail(fastFail bool)
 	SentNum() uint64
@@ -41,7 +42,7 @@ func NewItemPipeline(itemProcessors []ProcessItem) (ItemPipeline,error){
 }
 
 
-func (ppi * itemPipelineImpl)Send(itemsMap basic.ItemMap)[]error{
+func (ppi * itemPipelineImpl)Send(ctx context.Context, itemsMap basic.ItemMap)[]error{
 	atomic.AddUint64(&ppi.sentNum,1)
 	atomic.AddUint64(&ppi.processingNum,1)
 	defer atomic.AddUint64(&ppi.processingNum, ^uint64(0))
@@ -56,7 +57,11 @@ func (ppi * itemPipelineImpl)Send(itemsMap basic.ItemMap)[]error{
 	var currentItem=itemsMap
 
 	for _,processor:=range ppi.itemProcessors{
-		tempItem,err:=processor(currentItem)
+		if err:=ctx.Err();err!=nil {
+			errs = append(errs, err)
+			break
+		}
+		tempItem,err:=processor(ctx,currentItem)
 		if err!=nil {
 			errs = append(errs, err)
 			if ppi.failFast == true {
@@ -1,5 +1,9 @@
 package itemproc
 
-import "chaoshen.com/crawlergo/crawler/basic"
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"context"
+)
 
-type ProcessItem func(item basic.ItemMap) (result basic.ItemMap, err error)
+// 条目处理函数，ctx被取消时应尽快返回。
+type ProcessItem func(ctx context.Context, item basic.ItemMap) (result basic.ItemMap, err error)
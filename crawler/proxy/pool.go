@@ -0,0 +1,345 @@
+package proxy
+
+import (
+	"chaoshen.com/crawlergo/crawler/util"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 选择代理的策略。
+type Strategy string
+
+const (
+	STRATEGY_ROUND_ROBIN    Strategy = "round-robin"    // 依次轮换。
+	STRATEGY_STICKY         Strategy = "sticky"         // 同一主域名固定使用同一个代理。
+	STRATEGY_LEAST_FAILURES Strategy = "least-failures" // 选择失败次数最少的代理。
+)
+
+// 没有可用代理时返回的错误。
+var ErrNoProxy = errors.New("No proxy is available.")
+
+// 代理池的接口类型。
+type Pool interface {
+	// 为请求选择一个可用的代理。
+	Select(req *http.Request) (*url.URL, error)
+	// 报告一次经由代理的请求是否失败，连续失败过多的代理会被隔离一段时间。
+	Report(proxy *url.URL, failed bool)
+	// 供http.Transport使用的代理函数，使用请求上下文中已选择的代理。
+	Proxy(req *http.Request) (*url.URL, error)
+	Stats() []Stat   // 获得各个代理的统计信息。
+	Summary() string // 获得摘要信息。
+}
+
+// 单个代理的统计信息。
+type Stat struct {
+	Proxy            string    // 隐去密码的代理URL。
+	Requests         uint64    // 请求次数。
+	Failures         uint64    // 失败次数。
+	Consecutive      uint32    // 连续失败次数。
+	QuarantinedUntil time.Time // 隔离的结束时间，零值表示未被隔离。
+	Unhealthy        bool      // 隔离后尚未通过健康检查。
+}
+
+// 代理的健康检查。被隔离的代理在隔离结束后需经由它成功请求URL才能重新加入代理池，
+// 检查失败的代理继续留在池外，每隔Interval再检查一次。
+type HealthCheck struct {
+	URL      string        // 检查时请求的URL，响应的状态码小于400视为健康。
+	Interval time.Duration // 同一个代理两次检查的最小间隔。
+	Timeout  time.Duration // 单次检查的超时，为0时使用Interval。
+}
+
+// 代理池中的一个代理。
+type entry struct {
+	url              *url.URL
+	requests         uint64
+	failures         uint64
+	consecutive      uint32
+	quarantinedUntil time.Time
+	unhealthy        bool      // 隔离后尚未通过健康检查。
+	probing          bool      // 正在进行健康检查。
+	lastProbe        time.Time // 上一次健康检查的开始时间。
+}
+
+// 代理池的实现类型。
+type poolImpl struct {
+	lock        sync.Mutex
+	strategy    Strategy
+	entries     []*entry
+	index       map[string]*entry // 以代理URL为键。
+	next        int               // 轮换的下一个位置。
+	sticky      map[string]*entry // 主域名固定使用的代理。
+	maxFailures uint32            // 连续失败多少次后隔离。
+	coolDown    time.Duration     // 隔离的时长。
+	healthCheck *HealthCheck      // 隔离结束后的健康检查，为nil时隔离结束即重新加入。
+}
+
+// 创建代理池。proxies为代理的URL，支持http、https与socks5，
+// 连续失败maxFailures次的代理会被隔离coolDown时长，期间不会被选择。
+func NewPool(proxies []string, strategy Strategy, maxFailures uint32, coolDown time.Duration) (Pool, error) {
+	return newPool(proxies, strategy, maxFailures, coolDown)
+}
+
+// 创建带健康检查的代理池。被隔离的代理在隔离结束后由选择代理的调用触发健康检查，
+// 检查在后台进行，通过后才会重新被选择。
+func NewPoolWithHealthCheck(proxies []string, strategy Strategy, maxFailures uint32, coolDown time.Duration,
+	check HealthCheck) (Pool, error) {
+	u, err := url.Parse(check.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("The health check url is invalid: %s", check.URL)
+	}
+	if check.Interval <= 0 || check.Timeout < 0 {
+		return nil, errors.New("The health check interval and timeout are invalid.")
+	}
+	pool, err := newPool(proxies, strategy, maxFailures, coolDown)
+	if err != nil {
+		return nil, err
+	}
+	pool.healthCheck = &check
+	return pool, nil
+}
+
+func newPool(proxies []string, strategy Strategy, maxFailures uint32, coolDown time.Duration) (*poolImpl, error) {
+	if len(proxies) == 0 {
+		return nil, errors.New("The proxy list can not be empty.")
+	}
+	switch strategy {
+	case STRATEGY_ROUND_ROBIN, STRATEGY_STICKY, STRATEGY_LEAST_FAILURES:
+	default:
+		return nil, fmt.Errorf("Unsupported proxy strategy: %s", strategy)
+	}
+	if maxFailures == 0 || coolDown <= 0 {
+		return nil, errors.New("The quarantine parameters of proxy pool are invalid.")
+	}
+	pool := &poolImpl{
+		strategy:    strategy,
+		index:       map[string]*entry{},
+		sticky:      map[string]*entry{},
+		maxFailures: maxFailures,
+		coolDown:    coolDown,
+	}
+	for _, raw := range proxies {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, err
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("Unsupported proxy scheme: %s", u.Scheme)
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("The proxy host can not be empty: %s", raw)
+		}
+		if _, ok := pool.index[u.String()]; ok {
+			continue
+		}
+		e := &entry{url: u}
+		pool.entries = append(pool.entries, e)
+		pool.index[u.String()] = e
+	}
+	return pool, nil
+}
+
+func (pool *poolImpl) Select(req *http.Request) (*url.URL, error) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	now := time.Now()
+	pool.probeQuarantined(now)
+	var selected *entry
+	switch pool.strategy {
+	case STRATEGY_STICKY:
+		domain := stickyKey(req)
+		if e, ok := pool.sticky[domain]; ok && e.available(now) {
+			selected = e
+		} else if selected = pool.roundRobin(now); selected != nil {
+			pool.sticky[domain] = selected
+		}
+	case STRATEGY_LEAST_FAILURES:
+		for _, e := range pool.entries {
+			if !e.available(now) {
+				continue
+			}
+			if selected == nil || e.failures < selected.failures ||
+				e.failures == selected.failures && e.requests < selected.requests {
+				selected = e
+			}
+		}
+	default:
+		selected = pool.roundRobin(now)
+	}
+	if selected == nil {
+		return nil, ErrNoProxy
+	}
+	selected.requests++
+	return selected.url, nil
+}
+
+// 从上一次的位置开始选择下一个可用的代理。
+func (pool *poolImpl) roundRobin(now time.Time) *entry {
+	for i := 0; i < len(pool.entries); i++ {
+		e := pool.entries[(pool.next+i)%len(pool.entries)]
+		if e.available(now) {
+			pool.next = (pool.next + i + 1) % len(pool.entries)
+			return e
+		}
+	}
+	return nil
+}
+
+func (pool *poolImpl) Report(proxy *url.URL, failed bool) {
+	if proxy == nil {
+		return
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	e, ok := pool.index[proxy.String()]
+	if !ok {
+		return
+	}
+	if !failed {
+		e.consecutive = 0
+		return
+	}
+	e.failures++
+	e.consecutive++
+	if e.consecutive >= pool.maxFailures {
+		e.quarantinedUntil = time.Now().Add(pool.coolDown)
+		e.consecutive = 0
+		e.unhealthy = pool.healthCheck != nil
+	}
+}
+
+// 对隔离已结束但尚未通过健康检查的代理发起检查，每个代理每隔Interval最多检查一次。
+func (pool *poolImpl) probeQuarantined(now time.Time) {
+	if pool.healthCheck == nil {
+		return
+	}
+	for _, e := range pool.entries {
+		if !e.unhealthy || e.probing || now.Before(e.quarantinedUntil) ||
+			now.Sub(e.lastProbe) < pool.healthCheck.Interval {
+			continue
+		}
+		e.probing = true
+		e.lastProbe = now
+		go pool.probe(e)
+	}
+}
+
+// 检查代理，通过时让它重新加入代理池。
+func (pool *poolImpl) probe(e *entry) {
+	err := pool.healthCheck.check(e.url)
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	e.probing = false
+	if err == nil {
+		e.unhealthy = false
+		e.consecutive = 0
+	}
+}
+
+// 经由代理请求健康检查的URL。
+func (check *HealthCheck) check(proxy *url.URL) error {
+	timeout := check.Timeout
+	if timeout == 0 {
+		timeout = check.Interval
+	}
+	transport := &http.Transport{Proxy: http.ProxyURL(proxy)}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: timeout}
+	resp, err := client.Get(check.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("The health check of proxy %s failed: status code %d", proxy.Redacted(), resp.StatusCode)
+	}
+	return nil
+}
+
+func (pool *poolImpl) Proxy(req *http.Request) (*url.URL, error) {
+	if proxy, ok := FromContext(req.Context()); ok {
+		return proxy, nil
+	}
+	return nil, nil
+}
+
+func (pool *poolImpl) Stats() []Stat {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	now := time.Now()
+	stats := make([]Stat, 0, len(pool.entries))
+	for _, e := range pool.entries {
+		stat := Stat{
+			Proxy:       e.url.Redacted(),
+			Requests:    e.requests,
+			Failures:    e.failures,
+			Consecutive: e.consecutive,
+		}
+		if !e.available(now) {
+			stat.QuarantinedUntil = e.quarantinedUntil
+			stat.Unhealthy = e.unhealthy
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+func (pool *poolImpl) Summary() string {
+	stats := pool.Stats()
+	available := 0
+	details := make([]string, 0, len(stats))
+	for _, stat := range stats {
+		state := "ok"
+		switch {
+		case stat.QuarantinedUntil.IsZero():
+			available++
+		case stat.QuarantinedUntil.After(time.Now()):
+			state = "quarantined until " + stat.QuarantinedUntil.Format(time.RFC3339)
+		default:
+			state = "waiting for health check"
+		}
+		details = append(details, fmt.Sprintf("%s(requests: %d, failures: %d, %s)",
+			stat.Proxy, stat.Requests, stat.Failures, state))
+	}
+	return fmt.Sprintf("strategy: %s, available: %d/%d, proxies: [%s]",
+		pool.strategy, available, len(stats), strings.Join(details, ", "))
+}
+
+func (e *entry) available(now time.Time) bool {
+	return !now.Before(e.quarantinedUntil) && !e.unhealthy
+}
+
+// 固定代理时使用的键：请求主机的主域名，无法识别时使用主机名。
+func stickyKey(req *http.Request) string {
+	if req == nil || req.URL == nil {
+		return ""
+	}
+	host := req.URL.Hostname()
+	if domain, err := util.GetPrimaryDomain(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+type contextKey struct{}
+
+// 在上下文中记录为请求选择的代理。
+func NewContext(ctx context.Context, proxy *url.URL) context.Context {
+	return context.WithValue(ctx, contextKey{}, proxy)
+}
+
+// 获得上下文中记录的代理。
+func FromContext(ctx context.Context) (*url.URL, bool) {
+	proxy, ok := ctx.Value(contextKey{}).(*url.URL)
+	return proxy, ok && proxy != nil
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolRoundRobinAndQuarantine(t *testing.T) {
+	pool, err := NewPool([]string{"http://p1:8080", "socks5://p2:1080"}, STRATEGY_ROUND_ROBIN, 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "http://www.a.com/", nil)
+	first, _ := pool.Select(req)
+	second, _ := pool.Select(req)
+	if first.Host == second.Host {
+		t.Fatalf("The proxies should be rotated: %s, %s", first, second)
+	}
+	pool.Report(first, true)
+	pool.Report(first, true)
+	for i := 0; i < 3; i++ {
+		if selected, _ := pool.Select(req); selected.Host != second.Host {
+			t.Fatalf("The quarantined proxy %s should not be selected.", selected)
+		}
+	}
+	pool.Report(second, true)
+	pool.Report(second, true)
+	if _, err := pool.Select(req); err != ErrNoProxy {
+		t.Fatalf("Expected ErrNoProxy, got %v", err)
+	}
+}
+
+func TestPoolSticky(t *testing.T) {
+	pool, err := NewPool([]string{"http://p1:8080", "http://p2:8080", "http://p3:8080"}, STRATEGY_STICKY, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := http.NewRequest("GET", "http://www.a.com/", nil)
+	img, _ := http.NewRequest("GET", "http://img.a.com/", nil)
+	b, _ := http.NewRequest("GET", "http://www.b.com/", nil)
+	first, _ := pool.Select(a)
+	if selected, _ := pool.Select(img); selected != first {
+		t.Fatalf("The same primary domain should stick to %s, got %s", first, selected)
+	}
+	if selected, _ := pool.Select(b); selected == first {
+		t.Fatalf("Another domain should get another proxy.")
+	}
+	pool.Report(first, true)
+	if selected, _ := pool.Select(a); selected == first {
+		t.Fatal("The quarantined sticky proxy should be replaced.")
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	var healthy, probes int32
+	// 代理服务器直接应答经由它的健康检查请求。
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "health.example.com" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(&probes, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer proxyServer.Close()
+	check := HealthCheck{URL: "http://health.example.com/", Interval: 10 * time.Millisecond}
+	pool, err := NewPoolWithHealthCheck([]string{proxyServer.URL}, STRATEGY_ROUND_ROBIN, 1, 10*time.Millisecond, check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "http://www.a.com/", nil)
+	proxy, err := pool.Select(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Report(proxy, true)
+
+	// 隔离结束后检查失败的代理不会重新加入。
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&probes) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the health check.")
+		}
+		if selected, err := pool.Select(req); err != ErrNoProxy {
+			t.Fatalf("The unhealthy proxy should not be selected, got %v %v", selected, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := pool.Stats(); !stats[0].Unhealthy {
+		t.Fatalf("The proxy should be reported as unhealthy: %+v", stats[0])
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	for {
+		if time.Now().After(deadline) {
+			t.Fatal("The healthy proxy should rejoin the pool.")
+		}
+		if selected, err := pool.Select(req); err == nil {
+			if selected.String() != proxy.String() {
+				t.Fatalf("Unexpected proxy %s", selected)
+			}
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := pool.Stats(); stats[0].Unhealthy || !stats[0].QuarantinedUntil.IsZero() {
+		t.Fatalf("The proxy should be available: %+v", stats[0])
+	}
+}
+
+func TestPoolHealthCheckInvalid(t *testing.T) {
+	invalid := []HealthCheck{
+		{URL: "", Interval: time.Second},
+		{URL: "ftp://health.example.com/", Interval: time.Second},
+		{URL: "http://health.example.com/"},
+		{URL: "http://health.example.com/", Interval: time.Second, Timeout: -time.Second},
+	}
+	for _, check := range invalid {
+		if _, err := NewPoolWithHealthCheck([]string{"http://p1:8080"}, STRATEGY_ROUND_ROBIN, 1, time.Hour, check); err == nil {
+			t.Errorf("Expected error for health check %+v", check)
+		}
+	}
+}
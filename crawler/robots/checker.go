@@ -0,0 +1,185 @@
+package robots
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/downloader"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robots.txt的最大读取长度。
+const maxRobotsSize = 500 * 1024
+
+// robots.txt无法获取时，禁止访问的持续时间。
+const unavailableTTL = time.Minute
+
+// 按主机缓存的robots.txt。
+type cacheEntry struct {
+	ready   chan struct{} // 获取完成后关闭。
+	data    *RobotsData   // 解析结果。
+	reason  string        // 无法获取时的原因。
+	expires time.Time     // 过期时间。
+}
+
+// robots.txt检查器，使用网页下载器池获取并缓存各主机的robots.txt。
+type Checker struct {
+	sync.Mutex
+	userAgent string
+	dlPool    downloader.PageDownloaderPool
+	ttl       time.Duration
+	entries   map[string]*cacheEntry
+}
+
+// 创建robots.txt检查器，userAgent用于匹配规则组及获取robots.txt，ttl为缓存时间。
+func NewChecker(userAgent string, dlPool downloader.PageDownloaderPool, ttl time.Duration) (*Checker, error) {
+	if strings.TrimSpace(userAgent) == "" {
+		return nil, errors.New("The robots user-agent can not be empty.")
+	}
+	if dlPool == nil {
+		return nil, errors.New("The page downloader pool can not be nil.")
+	}
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &Checker{
+		userAgent: userAgent,
+		dlPool:    dlPool,
+		ttl:       ttl,
+		entries:   make(map[string]*cacheEntry),
+	}, nil
+}
+
+// 判断是否允许访问URL，不允许时返回原因。非HTTP(S)的URL总是允许。
+// 获取robots.txt时ctx被取消则视为禁止访问。
+func (checker *Checker) Allowed(ctx context.Context, u *url.URL) (bool, string) {
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return true, ""
+	}
+	entry := checker.get(ctx, u)
+	if entry.data.TestAgent(u, checker.userAgent) {
+		return true, ""
+	}
+	if entry.reason != "" {
+		return false, entry.reason
+	}
+	return false, fmt.Sprintf("disallowed by %s", robotsURL(u))
+}
+
+// 获得URL所在主机声明的爬取间隔。
+func (checker *Checker) CrawlDelay(ctx context.Context, u *url.URL) time.Duration {
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return 0
+	}
+	return checker.get(ctx, u).data.CrawlDelay(checker.userAgent)
+}
+
+// 获得主机的robots.txt，同一主机并发的请求只获取一次。
+// 因ctx被取消而未能获取的结果不会被缓存。
+func (checker *Checker) get(ctx context.Context, u *url.URL) *cacheEntry {
+	key := robotsURL(u)
+	checker.Lock()
+	entry, ok := checker.entries[key]
+	if ok {
+		select {
+		case <-entry.ready:
+			if time.Now().After(entry.expires) {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		entry = &cacheEntry{ready: make(chan struct{})}
+		checker.entries[key] = entry
+		checker.Unlock()
+		checker.fetch(ctx, key, entry)
+		if ctx.Err() != nil {
+			checker.Lock()
+			if checker.entries[key] == entry {
+				delete(checker.entries, key)
+			}
+			checker.Unlock()
+		}
+		close(entry.ready)
+		return entry
+	}
+	checker.Unlock()
+	select {
+	case <-entry.ready:
+		return entry
+	case <-ctx.Done():
+		return &cacheEntry{
+			data:   DisallowAll(),
+			reason: fmt.Sprintf("%s is unavailable: %s", key, ctx.Err()),
+		}
+	}
+}
+
+// 获取并解析robots.txt。
+// 4xx表示没有限制；网络错误与5xx视为禁止访问，并在较短时间后重试。
+func (checker *Checker) fetch(ctx context.Context, key string, entry *cacheEntry) {
+	body, status, err := checker.download(ctx, key)
+	switch {
+	case err != nil:
+		entry.data = DisallowAll()
+		entry.reason = fmt.Sprintf("%s is unavailable: %s", key, err)
+		entry.expires = time.Now().Add(unavailableTTL)
+	case status >= 500:
+		entry.data = DisallowAll()
+		entry.reason = fmt.Sprintf("%s is unavailable: status code %d", key, status)
+		entry.expires = time.Now().Add(unavailableTTL)
+	case status >= 400:
+		entry.data = AllowAll()
+		entry.expires = time.Now().Add(checker.ttl)
+	default:
+		entry.data = Parse(body)
+		entry.expires = time.Now().Add(checker.ttl)
+	}
+}
+
+func (checker *Checker) download(ctx context.Context, robotsUrl string) ([]byte, int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", robotsUrl, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	httpReq.Header.Set("User-Agent", checker.userAgent)
+	dl, err := checker.dlPool.Take()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer checker.dlPool.Return(dl)
+	resp, err := dl.Download(basic.NewDownloadRequest(0, httpReq, 0))
+	if err != nil {
+		return nil, 0, err
+	}
+	httpResp := resp.HttpResp()
+	defer httpResp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, maxRobotsSize))
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, httpResp.StatusCode, nil
+}
+
+func robotsURL(u *url.URL) string {
+	return fmt.Sprintf("%s://%s/robots.txt", strings.ToLower(u.Scheme), strings.ToLower(u.Host))
+}
+
+// 摘要信息模板。
+var summaryTemplate = "userAgent: %s, hosts: %d"
+
+func (checker *Checker) Summary() string {
+	checker.Lock()
+	defer checker.Unlock()
+	return fmt.Sprintf(summaryTemplate, checker.userAgent, len(checker.entries))
+}
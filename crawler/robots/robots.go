@@ -0,0 +1,206 @@
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 一条Allow或Disallow规则。
+type rule struct {
+	allow   bool   // 是否为Allow规则。
+	pattern string // 路径模式，支持通配符'*'与结尾锚点'$'。
+}
+
+// 针对一组user-agent的规则。
+type group struct {
+	agents     []string      // 小写的user-agent。
+	rules      []rule        // 规则列表。
+	crawlDelay time.Duration // 爬取间隔。
+}
+
+// robots.txt的解析结果。
+type RobotsData struct {
+	groups     []*group
+	allowAll   bool     // 是否允许所有请求。
+	disallowed bool     // 是否禁止所有请求。
+	sitemaps   []string // 声明的站点地图。
+}
+
+// 允许所有请求的结果，用于robots.txt不存在的情况。
+func AllowAll() *RobotsData {
+	return &RobotsData{allowAll: true}
+}
+
+// 禁止所有请求的结果，用于robots.txt无法获取的情况。
+func DisallowAll() *RobotsData {
+	return &RobotsData{disallowed: true}
+}
+
+// 解析robots.txt的内容，无法识别的行会被忽略。
+func Parse(body []byte) *RobotsData {
+	data := &RobotsData{}
+	var current *group
+	// 上一行是否为user-agent行，连续的user-agent行属于同一组。
+	lastAgent := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		index := strings.Index(line, ":")
+		if index < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:index]))
+		value := strings.TrimSpace(line[index+1:])
+		switch key {
+		case "user-agent":
+			if !lastAgent || current == nil {
+				current = &group{}
+				data.groups = append(data.groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastAgent = true
+			continue
+		case "allow", "disallow":
+			// 空的Disallow表示不限制，忽略即可。
+			if current != nil && value != "" {
+				current.rules = append(current.rules, rule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if current != nil {
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					current.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			data.sitemaps = append(data.sitemaps, value)
+		}
+		lastAgent = false
+	}
+	return data
+}
+
+// 查找与user-agent匹配的规则组。
+// 名称最长的匹配组优先，同名的多个组合并，没有匹配时使用'*'组。
+func (data *RobotsData) findGroup(userAgent string) *group {
+	userAgent = strings.ToLower(userAgent)
+	var matched *group
+	matchedLen := -1
+	var wildcard *group
+	for _, g := range data.groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				wildcard = mergeGroup(wildcard, g)
+				continue
+			}
+			if agent == "" || !strings.Contains(userAgent, agent) {
+				continue
+			}
+			if len(agent) > matchedLen {
+				matched = mergeGroup(nil, g)
+				matchedLen = len(agent)
+			} else if len(agent) == matchedLen {
+				matched = mergeGroup(matched, g)
+			}
+		}
+	}
+	if matched != nil {
+		return matched
+	}
+	return wildcard
+}
+
+func mergeGroup(dst *group, src *group) *group {
+	if dst == nil {
+		return &group{rules: append([]rule(nil), src.rules...), crawlDelay: src.crawlDelay}
+	}
+	dst.rules = append(dst.rules, src.rules...)
+	if src.crawlDelay > dst.crawlDelay {
+		dst.crawlDelay = src.crawlDelay
+	}
+	return dst
+}
+
+// 判断user-agent是否允许访问URL。
+// 匹配最长的规则生效，长度相同时Allow优先。
+func (data *RobotsData) TestAgent(u *url.URL, userAgent string) bool {
+	if data.allowAll {
+		return true
+	}
+	if data.disallowed {
+		return false
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	g := data.findGroup(userAgent)
+	if g == nil {
+		return true
+	}
+	allowed := true
+	matchedLen := -1
+	for _, r := range g.rules {
+		if !matchPattern(r.pattern, path) {
+			continue
+		}
+		if len(r.pattern) > matchedLen || (len(r.pattern) == matchedLen && r.allow) {
+			allowed = r.allow
+			matchedLen = len(r.pattern)
+		}
+	}
+	return allowed
+}
+
+// 获得user-agent的爬取间隔，未声明时返回0。
+func (data *RobotsData) CrawlDelay(userAgent string) time.Duration {
+	g := data.findGroup(userAgent)
+	if g == nil {
+		return 0
+	}
+	return g.crawlDelay
+}
+
+// 获得声明的站点地图。
+func (data *RobotsData) Sitemaps() []string {
+	return data.sitemaps
+}
+
+// 判断路径是否匹配模式，模式从路径开头匹配。
+func matchPattern(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if i == len(parts)-1 && anchored {
+			return strings.HasSuffix(path[pos:], parts[i])
+		}
+		index := strings.Index(path[pos:], parts[i])
+		if index < 0 {
+			return false
+		}
+		pos += index + len(parts[i])
+	}
+	if anchored {
+		return pos == len(path)
+	}
+	return true
+}
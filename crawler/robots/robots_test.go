@@ -0,0 +1,148 @@
+package robots
+
+import (
+	"chaoshen.com/crawlergo/crawler/downloader"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRobots = `
+# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public
+Disallow: /*.pdf$
+
+User-agent: crawlergo
+User-agent: otherbot
+Disallow: /tmp
+Crawl-delay: 2.5
+
+Sitemap: http://a.com/sitemap.xml
+`
+
+func TestRobotsData(t *testing.T) {
+	data := Parse([]byte(testRobots))
+	cases := []struct {
+		agent   string
+		url     string
+		allowed bool
+	}{
+		{"Mozilla/5.0", "http://a.com/index.html", true},
+		{"Mozilla/5.0", "http://a.com/private/x", false},
+		{"Mozilla/5.0", "http://a.com/private/public/x", true},
+		{"Mozilla/5.0", "http://a.com/doc/a.pdf", false},
+		{"Mozilla/5.0", "http://a.com/doc/a.pdf?x=1", true},
+		{"Crawlergo/1.0", "http://a.com/private/x", true},
+		{"Crawlergo/1.0", "http://a.com/tmp/x", false},
+		{"Crawlergo/1.0", "http://a.com/robots.txt", true},
+	}
+	for _, c := range cases {
+		u, _ := url.Parse(c.url)
+		if allowed := data.TestAgent(u, c.agent); allowed != c.allowed {
+			t.Errorf("TestAgent(%s, %s) = %v, expected %v.", c.url, c.agent, allowed, c.allowed)
+		}
+	}
+	if delay := data.CrawlDelay("crawlergo"); delay != 2500*time.Millisecond {
+		t.Errorf("Crawl delay is %s, expected 2.5s.", delay)
+	}
+	if delay := data.CrawlDelay("Mozilla/5.0"); delay != 0 {
+		t.Errorf("Crawl delay is %s, expected 0.", delay)
+	}
+	if len(data.Sitemaps()) != 1 {
+		t.Errorf("Sitemaps %v, expected one sitemap.", data.Sitemaps())
+	}
+}
+
+func TestChecker(t *testing.T) {
+	var fetched int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&fetched, 1)
+		fmt.Fprint(w, testRobots)
+	}))
+	defer server.Close()
+
+	dlPool, err := downloader.NewPageDownloaderPool(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker, err := NewChecker("crawlergo", dlPool, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(server.URL + "/tmp/a.html")
+	if allowed, reason := checker.Allowed(context.Background(), u); allowed || reason == "" {
+		t.Errorf("Allowed(%s) = %v, %q, expected to be rejected with a reason.", u, allowed, reason)
+	}
+	u, _ = url.Parse(server.URL + "/a.html")
+	if allowed, _ := checker.Allowed(context.Background(), u); !allowed {
+		t.Errorf("Allowed(%s) = false, expected true.", u)
+	}
+	if fetched != 1 {
+		t.Errorf("robots.txt fetched %d times, expected once.", fetched)
+	}
+	if dlPool.Used() != 0 {
+		t.Errorf("The downloader pool has %d downloaders in use.", dlPool.Used())
+	}
+}
+
+func TestCheckerCancel(t *testing.T) {
+	var fetched int32
+	hang := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次获取一直阻塞，直到被客户端中止。
+		if atomic.AddInt32(&fetched, 1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-hang:
+			}
+			return
+		}
+		fmt.Fprint(w, testRobots)
+	}))
+	defer server.Close()
+	defer close(hang)
+
+	dlPool, err := downloader.NewPageDownloaderPool(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker, err := NewChecker("crawlergo", dlPool, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(server.URL + "/a.html")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool, 1)
+	go func() {
+		allowed, _ := checker.Allowed(ctx, u)
+		done <- allowed
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case allowed := <-done:
+		if allowed {
+			t.Error("The canceled check should not be allowed.")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The canceled check should return without waiting for robots.txt.")
+	}
+	// 被取消的获取结果不被缓存，之后重新获取。
+	if allowed, reason := checker.Allowed(context.Background(), u); !allowed {
+		t.Errorf("Allowed(%s) = false, %q, expected true.", u, reason)
+	}
+	if atomic.LoadInt32(&fetched) != 2 {
+		t.Errorf("robots.txt fetched %d times, expected twice.", fetched)
+	}
+}
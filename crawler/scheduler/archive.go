@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"chaoshen.com/crawlergo/crawler/downloader"
+	"chaoshen.com/crawlergo/crawler/warc"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// WARC归档的设置。
+type warcConfig struct {
+	dir     string
+	prefix  string
+	maxSize int64
+}
+
+// 创建WARC写入器，并将写入WARC文件的中间件加在所有中间件之后，
+// 使其最先处理下载得到的响应，记录的是实际下载的内容。
+func (sched *schedulerImpl) initArchive() error {
+	if sched.warcConfig == nil {
+		return nil
+	}
+	if sched.replayStore != nil {
+		return errors.New("The warc archive can not be written in replay mode.")
+	}
+	config := sched.warcConfig
+	writer, err := warc.NewWriter(config.dir, config.prefix, config.maxSize, sched.warcInfo())
+	if err != nil {
+		return err
+	}
+	sched.warcWriter = writer
+	sched.middlewares = append(sched.middlewares, downloader.NewWARCMiddleware(writer))
+	return nil
+}
+
+// 描述爬取配置的warcinfo字段。
+func (sched *schedulerImpl) warcInfo() []warc.Field {
+	hostname, _ := os.Hostname()
+	limits := sched.limits()
+	fields := []warc.Field{
+		{Name: "software", Value: "crawlergo"},
+		{Name: "format", Value: "WARC File Format 1.0"},
+		{Name: "conformsTo", Value: "http://bibnum.bnf.fr/WARC/WARC_ISO_28500_version1_latestdraft.pdf"},
+		{Name: "hostname", Value: hostname},
+		{Name: "crawl-max-depth", Value: fmt.Sprintf("%d", sched.crawMaxDepth)},
+		{Name: "channel-config", Value: sched.channelConfig.Summary()},
+		{Name: "pool-config", Value: sched.poolBaseConfig.Summary()},
+		{Name: "download-limits", Value: limits.Summary()},
+		{Name: "schemes", Value: strings.Join(sched.schemes.Schemes(), ",")},
+	}
+	if sched.robotsAgent != "" {
+		fields = append(fields, warc.Field{Name: "robots", Value: "obey, agent: " + sched.robotsAgent})
+	}
+	if sched.retryPolicy != nil {
+		fields = append(fields, warc.Field{Name: "retry-policy", Value: sched.retryPolicy.Summary()})
+	}
+	return fields
+}
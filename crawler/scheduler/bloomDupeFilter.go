@@ -0,0 +1,157 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// 可扩展布隆过滤器中，每个新的子过滤器的容量增长倍数。
+const bloomGrowth = 2
+
+// 可扩展布隆过滤器中，每个新的子过滤器的误判率收紧比例。
+const bloomTightening = 0.9
+
+// 单个布隆过滤器。
+type bloomFilter struct {
+	bits     []uint64 // 位数组。
+	m        uint64   // 位数。
+	k        uint64   // 哈希函数个数。
+	capacity uint64   // 容量。
+	count    uint64   // 已加入的键的数量。
+}
+
+func newBloomFilter(capacity uint64, falsePositiveRate float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Ceil(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k, capacity: capacity}
+}
+
+func (bf *bloomFilter) contains(h1 uint64, h2 uint64) bool {
+	for i := uint64(0); i < bf.k; i++ {
+		index := (h1 + i*h2) % bf.m
+		if bf.bits[index/64]&(1<<(index%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (bf *bloomFilter) add(h1 uint64, h2 uint64) {
+	for i := uint64(0); i < bf.k; i++ {
+		index := (h1 + i*h2) % bf.m
+		bf.bits[index/64] |= 1 << (index % 64)
+	}
+	bf.count++
+}
+
+// 可扩展的布隆过滤器去重器。
+// 当前子过滤器写满后追加一个容量翻倍、误判率收紧的子过滤器，总误判率不超过设定值。
+// 误判会使少量未见过的请求被当作重复请求忽略。
+type bloomDupeFilter struct {
+	sync.Mutex
+	filters           []*bloomFilter
+	initialCapacity   uint64
+	falsePositiveRate float64
+	count             uint64
+}
+
+// 创建可扩展的布隆过滤器去重器，initialCapacity为第一个子过滤器的容量，
+// falsePositiveRate为期望的总误判率。
+func NewBloomDupeFilter(initialCapacity uint64, falsePositiveRate float64) (DupeFilter, error) {
+	if initialCapacity == 0 {
+		return nil, errors.New("The bloom filter capacity can not be 0.")
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, errors.New("The bloom filter false positive rate must be between 0 and 1.")
+	}
+	filter := &bloomDupeFilter{
+		initialCapacity:   initialCapacity,
+		falsePositiveRate: falsePositiveRate,
+	}
+	filter.grow()
+	return filter, nil
+}
+
+// 追加一个子过滤器。第i个子过滤器的误判率为p*(1-r)*r^i，其和不超过p。
+func (filter *bloomDupeFilter) grow() {
+	n := len(filter.filters)
+	capacity := filter.initialCapacity * uint64(math.Pow(bloomGrowth, float64(n)))
+	rate := filter.falsePositiveRate * (1 - bloomTightening) * math.Pow(bloomTightening, float64(n))
+	filter.filters = append(filter.filters, newBloomFilter(capacity, rate))
+}
+
+// 计算双重哈希使用的两个哈希值。
+func bloomHash(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h = fnv.New64()
+	h.Write([]byte(key))
+	h2 := h.Sum64() | 1
+	return h1, h2
+}
+
+func (filter *bloomDupeFilter) containsHash(h1 uint64, h2 uint64) bool {
+	for _, bf := range filter.filters {
+		if bf.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter *bloomDupeFilter) TestAndAdd(key string) bool {
+	h1, h2 := bloomHash(key)
+	filter.Lock()
+	defer filter.Unlock()
+	if filter.containsHash(h1, h2) {
+		return true
+	}
+	current := filter.filters[len(filter.filters)-1]
+	if current.count >= current.capacity {
+		filter.grow()
+		current = filter.filters[len(filter.filters)-1]
+	}
+	current.add(h1, h2)
+	filter.count++
+	return false
+}
+
+func (filter *bloomDupeFilter) Contains(key string) bool {
+	h1, h2 := bloomHash(key)
+	filter.Lock()
+	defer filter.Unlock()
+	return filter.containsHash(h1, h2)
+}
+
+func (filter *bloomDupeFilter) Count() uint64 {
+	filter.Lock()
+	defer filter.Unlock()
+	return filter.count
+}
+
+func (filter *bloomDupeFilter) MemoryUsage() uint64 {
+	filter.Lock()
+	defer filter.Unlock()
+	var usage uint64
+	for _, bf := range filter.filters {
+		usage += uint64(len(bf.bits)) * 8
+	}
+	return usage
+}
+
+func (filter *bloomDupeFilter) Summary() string {
+	filter.Lock()
+	defer filter.Unlock()
+	return fmt.Sprintf("bloom, count: %d, filters: %d, falsePositiveRate: %g",
+		filter.count, len(filter.filters), filter.falsePositiveRate)
+}
@@ -0,0 +1,252 @@
+package scheduler
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// 磁盘哈希集合文件的魔数。
+var diskSetMagic = [8]byte{'c', 'r', 'a', 'w', 'l', 'h', 's', '1'}
+
+// 文件头长度：魔数与槽位数。
+const diskSetHeaderSize = 16
+
+// 初始槽位数。
+const diskSetInitialSlots = 1 << 16
+
+// 基于磁盘的哈希集合去重器。
+// 文件中以开放寻址（线性探测）的方式保存键的64位指纹，0表示空槽位，
+// 装载率超过一半时扩容为两倍并重新散列。内存占用与记录数无关。
+type diskDupeFilter struct {
+	sync.Mutex
+	path  string
+	file  *os.File
+	slots uint64 // 槽位数。
+	count uint64 // 已记录的键的数量。
+}
+
+// 打开或创建基于磁盘的哈希集合去重器。
+func NewDiskDupeFilter(path string) (DupeFilter, error) {
+	if path == "" {
+		return nil, errors.New("The disk dupe filter path can not be empty.")
+	}
+	filter := &diskDupeFilter{path: path}
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		file, err = createDiskSet(path, diskSetInitialSlots)
+		if err != nil {
+			return nil, err
+		}
+		filter.file = file
+		filter.slots = diskSetInitialSlots
+		return filter, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	filter.file = file
+	if err := filter.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return filter, nil
+}
+
+// 创建指定槽位数的空文件。
+func createDiskSet(path string, slots uint64) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, diskSetHeaderSize)
+	copy(header, diskSetMagic[:])
+	binary.LittleEndian.PutUint64(header[8:], slots)
+	if _, err := file.WriteAt(header, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(diskSetHeaderSize + int64(slots)*8); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// 读取文件头并统计已记录的键的数量。
+func (filter *diskDupeFilter) load() error {
+	header := make([]byte, diskSetHeaderSize)
+	if _, err := filter.file.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if string(header[:8]) != string(diskSetMagic[:]) {
+		return fmt.Errorf("The file %s is not a disk dupe filter.", filter.path)
+	}
+	filter.slots = binary.LittleEndian.Uint64(header[8:])
+	if filter.slots == 0 {
+		return fmt.Errorf("The disk dupe filter %s is corrupted.", filter.path)
+	}
+	return filter.scan(filter.file, func(fingerprint uint64) error {
+		filter.count++
+		return nil
+	})
+}
+
+// 依次读取所有非空槽位。
+func (filter *diskDupeFilter) scan(file *os.File, handle func(fingerprint uint64) error) error {
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, diskSetHeaderSize, int64(filter.slots)*8), 64*1024)
+	slot := make([]byte, 8)
+	for i := uint64(0); i < filter.slots; i++ {
+		if _, err := io.ReadFull(reader, slot); err != nil {
+			return err
+		}
+		if fingerprint := binary.LittleEndian.Uint64(slot); fingerprint != 0 {
+			if err := handle(fingerprint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 计算键的64位指纹，0保留为空槽位。
+func diskSetFingerprint(key string) uint64 {
+	sum := sha1.Sum([]byte(key))
+	fingerprint := binary.LittleEndian.Uint64(sum[:8])
+	if fingerprint == 0 {
+		fingerprint = 1
+	}
+	return fingerprint
+}
+
+// 查找指纹所在的槽位或第一个空槽位。
+func probe(file *os.File, slots uint64, fingerprint uint64) (uint64, bool, error) {
+	slot := make([]byte, 8)
+	index := fingerprint % slots
+	for i := uint64(0); i < slots; i++ {
+		if _, err := file.ReadAt(slot, diskSetHeaderSize+int64(index)*8); err != nil {
+			return 0, false, err
+		}
+		value := binary.LittleEndian.Uint64(slot)
+		if value == fingerprint {
+			return index, true, nil
+		}
+		if value == 0 {
+			return index, false, nil
+		}
+		index = (index + 1) % slots
+	}
+	return 0, false, errors.New("The disk dupe filter is full.")
+}
+
+func writeSlot(file *os.File, index uint64, fingerprint uint64) error {
+	slot := make([]byte, 8)
+	binary.LittleEndian.PutUint64(slot, fingerprint)
+	_, err := file.WriteAt(slot, diskSetHeaderSize+int64(index)*8)
+	return err
+}
+
+// 扩容为两倍槽位并重新散列。
+func (filter *diskDupeFilter) grow() error {
+	tmpPath := filter.path + ".tmp"
+	slots := filter.slots * 2
+	tmp, err := createDiskSet(tmpPath, slots)
+	if err != nil {
+		return err
+	}
+	err = filter.scan(filter.file, func(fingerprint uint64) error {
+		index, _, err := probe(tmp, slots, fingerprint)
+		if err != nil {
+			return err
+		}
+		return writeSlot(tmp, index, fingerprint)
+	})
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, filter.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	filter.file.Close()
+	filter.file = tmp
+	filter.slots = slots
+	return nil
+}
+
+// 磁盘读写失败时视为未记录过，宁可重复下载也不丢失请求。
+func (filter *diskDupeFilter) TestAndAdd(key string) bool {
+	fingerprint := diskSetFingerprint(key)
+	filter.Lock()
+	defer filter.Unlock()
+	if filter.file == nil {
+		return false
+	}
+	if (filter.count+1)*2 > filter.slots {
+		if err := filter.grow(); err != nil {
+			return false
+		}
+	}
+	index, found, err := probe(filter.file, filter.slots, fingerprint)
+	if err != nil {
+		return false
+	}
+	if found {
+		return true
+	}
+	if err := writeSlot(filter.file, index, fingerprint); err != nil {
+		return false
+	}
+	filter.count++
+	return false
+}
+
+func (filter *diskDupeFilter) Contains(key string) bool {
+	fingerprint := diskSetFingerprint(key)
+	filter.Lock()
+	defer filter.Unlock()
+	if filter.file == nil {
+		return false
+	}
+	_, found, err := probe(filter.file, filter.slots, fingerprint)
+	return err == nil && found
+}
+
+func (filter *diskDupeFilter) Count() uint64 {
+	filter.Lock()
+	defer filter.Unlock()
+	return filter.count
+}
+
+// 内存占用与记录数无关，可以忽略。
+func (filter *diskDupeFilter) MemoryUsage() uint64 {
+	return 0
+}
+
+// 关闭文件。
+func (filter *diskDupeFilter) Close() error {
+	filter.Lock()
+	defer filter.Unlock()
+	if filter.file == nil {
+		return nil
+	}
+	err := filter.file.Close()
+	filter.file = nil
+	return err
+}
+
+func (filter *diskDupeFilter) Summary() string {
+	filter.Lock()
+	defer filter.Unlock()
+	return fmt.Sprintf("disk hash set, count: %d, slots: %d, file size: %d, path: %s",
+		filter.count, filter.slots, diskSetHeaderSize+filter.slots*8, filter.path)
+}
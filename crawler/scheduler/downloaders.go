@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/downloader"
+	"chaoshen.com/crawlergo/crawler/util"
+	"fmt"
+	"github.com/astaxie/beego/logs"
+	"net/http"
+	"net/url"
+)
+
+// 获得网页下载器的下载限制，未设置时截断超过basic.DefaultMaxBodySize的响应体。
+func (sched *schedulerImpl) limits() basic.DownloadLimitConfig {
+	if sched.downloadLimits != nil {
+		return *sched.downloadLimits
+	}
+	return basic.NewDownloadLimitConfig(basic.DefaultMaxBodySize, basic.OVERSIZE_TRUNCATE)
+}
+
+// 创建协议注册表并注册通过选项设置的协议下载器。
+func (sched *schedulerImpl) initSchemes() error {
+	sched.schemes = downloader.NewSchemeRegistry(sched.limits())
+	for scheme, fetcher := range sched.schemeFetchers {
+		if err := sched.schemes.Register(scheme, fetcher); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 生成组合了下载限制、HTTP缓存等功能的网页下载器，设置了Cookie容器时所有下载器共享同一个容器。
+// 非http协议的请求按协议注册表分派，不经过代理池与HTTP缓存，但同样经过中间件。
+// 回放模式下所有请求都从存档中读取，不访问网络，存档中的重定向按同样的策略处理。
+func (sched *schedulerImpl) genPageDownloader(genClient downloader.GenHttpClient) downloader.GenPageDownloader {
+	return func() downloader.PageDownloader {
+		if sched.replayStore != nil {
+			dl := downloader.NewReplayDownloaderWithPolicy(sched.replayStore, sched.canonicalizer, sched.redirectPolicy())
+			if len(sched.middlewares) > 0 {
+				dl = downloader.NewMiddlewareDownloader(dl, sched.middlewares...)
+			}
+			return dl
+		}
+		client, useProxy := sched.newHttpClient(genClient, sched.redirectPolicy())
+		dl := downloader.NewPageDownloaderWithLimits(client, sched.limits())
+		if useProxy {
+			dl = downloader.NewProxyDownloader(dl, sched.proxyPool)
+		}
+		if sched.httpCache != nil {
+			dl = downloader.NewCachingDownloader(dl, sched.httpCache, sched.canonicalizer)
+		}
+		dl = downloader.NewSchemeDownloader(dl, sched.schemes)
+		if len(sched.middlewares) > 0 {
+			dl = downloader.NewMiddlewareDownloader(dl, sched.middlewares...)
+		}
+		return dl
+	}
+}
+
+// 生成获取robots.txt的下载器，与网页下载器使用相同的传输层、代理池与Cookie容器，
+// 但不受下载限制的影响，也不经过HTTP缓存。robots.txt的重定向总是被跟随。
+func (sched *schedulerImpl) genRobotsDownloader(genClient downloader.GenHttpClient) downloader.GenPageDownloader {
+	return func() downloader.PageDownloader {
+		policy := downloader.RedirectPolicy{MaxRedirects: sched.maxRedirects, Follow: true}
+		client, useProxy := sched.newHttpClient(genClient, policy)
+		dl := downloader.NewPageDownloader(client)
+		if useProxy {
+			dl = downloader.NewProxyDownloader(dl, sched.proxyPool)
+		}
+		return dl
+	}
+}
+
+// 创建下载器使用的HTTP客户端，设置Cookie容器、重定向策略与代理池，成功设置代理池时返回true。
+// 设置了Cookie容器与代理池时所有下载器共享同一个容器与代理池。
+func (sched *schedulerImpl) newHttpClient(genClient downloader.GenHttpClient,
+	policy downloader.RedirectPolicy) (*http.Client, bool) {
+	// 复制生成的HTTP客户端，避免修改被多个下载器共用的客户端。
+	client := &http.Client{}
+	if genClient != nil {
+		if generated := genClient(); generated != nil {
+			copied := *generated
+			client = &copied
+		}
+	}
+	if sched.cookieJar != nil {
+		client.Jar = sched.cookieJar
+	}
+	downloader.UseRedirectPolicy(client, policy)
+	if sched.proxyPool == nil {
+		return client, false
+	}
+	if err := downloader.UseProxyPool(client, sched.proxyPool); err != nil {
+		logs.Warning("Download without proxy pool: %s", err)
+		return client, false
+	}
+	return client, true
+}
+
+// 获得网页下载器的重定向策略。
+func (sched *schedulerImpl) redirectPolicy() downloader.RedirectPolicy {
+	return downloader.RedirectPolicy{
+		MaxRedirects: sched.maxRedirects,
+		Follow:       !sched.queueRedirects,
+		Scope:        sched.inScope,
+	}
+}
+
+// 检查重定向的目标是否在许可范围内，与加入请求缓存时的协议与域名检查一致。
+func (sched *schedulerImpl) inScope(u *url.URL) error {
+	if !downloader.IsHTTPScheme(u.Scheme) {
+		return fmt.Errorf("the scheme '%s' is not allowed", u.Scheme)
+	}
+	domain, _ := util.GetPrimaryDomain(u.Host)
+	if !sched.permitted(domain) {
+		return fmt.Errorf("the host '%s' is not in primary domain", u.Host)
+	}
+	return nil
+}
+
+// 不跟随重定向时，将重定向的目标作为新的请求加入请求缓存，重定向的响应不再交给分析器。
+// 新请求与原请求的深度相同，经过同样的域名、深度与去重检查，并累计重定向的次数，
+// 超过maxRedirects时以basic.REDIRECT_ERROR类型的错误发送到错误通道。
+func (sched *schedulerImpl) queueRedirect(req *basic.DownloadRequest, respond *basic.DownloadRespond, code string) bool {
+	if !sched.queueRedirects {
+		return false
+	}
+	httpResp := respond.HttpResp()
+	location := downloader.RedirectLocation(httpResp)
+	if location == nil {
+		return false
+	}
+	httpReq := req.HttpReq()
+	redirects := req.Redirects() + 1
+	if redirects > sched.maxRedirects {
+		sched.sendError(basic.NewCrawlerError(basic.REDIRECT_ERROR,
+			fmt.Sprintf("Stopped after %d redirects. (requestUrl=%s, redirectUrl=%s)",
+				sched.maxRedirects, httpReq.URL, location)), code)
+		return true
+	}
+	// 307与308要求保持请求方法与请求体，其他重定向改为不带请求体的GET请求。
+	spec := req.Spec().WithURL(location.String())
+	if httpResp.StatusCode != http.StatusTemporaryRedirect && httpResp.StatusCode != http.StatusPermanentRedirect {
+		spec.Method = http.MethodGet
+		spec.Body = nil
+		spec.Header.Del("Content-Type")
+	}
+	next, err := basic.NewDownloadRequestFromSpec(req.GetID(), spec, req.Depth())
+	if err != nil {
+		logs.Debug("Create the redirect request error: %s (requestUrl=%s)\n", err, httpReq.URL)
+		return true
+	}
+	next.SetParentScore(req.ParentScore())
+	next.SetRedirects(redirects)
+	if err := sched.enqueue(next, httpReq.URL); err != nil {
+		if _, ok := err.(putError); ok {
+			sched.sendError(err, FRONTIER_CODE)
+		} else {
+			logs.Debug("%s\n", err)
+		}
+	} else {
+		logs.Info("Queue the redirect to %s. (requestUrl=%s)\n", location, httpReq.URL)
+	}
+	return true
+}
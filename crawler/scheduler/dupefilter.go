@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+)
+
+// 请求去重过滤器，记录已见请求的键（通常为规范化后的URL）。
+type DupeFilter interface {
+	TestAndAdd(key string) bool // 记录键，如果此前已经记录过则返回true。
+	Contains(key string) bool   // 判断键是否已经记录过。
+	Count() uint64              // 获得已记录的键的数量。
+	MemoryUsage() uint64        // 获得占用内存的估计字节数。
+	Summary() string            // 获得摘要信息。
+}
+
+// map中每个键的估计额外开销（字符串头与桶内空间）。
+const mapEntryOverhead = 48
+
+// 基于map的去重过滤器，保存完整的键，内存占用随记录数线性增长。
+type mapDupeFilter struct {
+	sync.RWMutex
+	seen  map[string]struct{}
+	bytes uint64 // 已记录的键的总长度。
+}
+
+// 创建基于map的去重过滤器。
+func NewMapDupeFilter() DupeFilter {
+	return &mapDupeFilter{seen: make(map[string]struct{})}
+}
+
+func (filter *mapDupeFilter) TestAndAdd(key string) bool {
+	filter.Lock()
+	defer filter.Unlock()
+	if _, ok := filter.seen[key]; ok {
+		return true
+	}
+	filter.seen[key] = struct{}{}
+	filter.bytes += uint64(len(key))
+	return false
+}
+
+func (filter *mapDupeFilter) Contains(key string) bool {
+	filter.RLock()
+	defer filter.RUnlock()
+	_, ok := filter.seen[key]
+	return ok
+}
+
+func (filter *mapDupeFilter) Count() uint64 {
+	filter.RLock()
+	defer filter.RUnlock()
+	return uint64(len(filter.seen))
+}
+
+func (filter *mapDupeFilter) MemoryUsage() uint64 {
+	filter.RLock()
+	defer filter.RUnlock()
+	return filter.bytes + uint64(len(filter.seen))*mapEntryOverhead
+}
+
+func (filter *mapDupeFilter) Summary() string {
+	return fmt.Sprintf("map, count: %d", filter.Count())
+}
+
+// 将新记录的键追加到行日志的去重过滤器，用于持久化的爬取边界。
+type loggedDupeFilter struct {
+	DupeFilter
+	log *lineLog
+}
+
+// 包装去重过滤器，已有的键需在打开行日志时回放到过滤器中。
+func newLoggedDupeFilter(filter DupeFilter, log *lineLog) DupeFilter {
+	return &loggedDupeFilter{DupeFilter: filter, log: log}
+}
+
+func (filter *loggedDupeFilter) TestAndAdd(key string) bool {
+	if filter.DupeFilter.TestAndAdd(key) {
+		return true
+	}
+	filter.log.Append(key)
+	return false
+}
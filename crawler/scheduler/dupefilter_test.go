@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBloomDupeFilter(t *testing.T) {
+	filter, err := NewBloomDupeFilter(100, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 1000
+	for i := 0; i < n; i++ {
+		filter.TestAndAdd(fmt.Sprintf("http://a.com/%d", i))
+	}
+	for i := 0; i < n; i++ {
+		if !filter.Contains(fmt.Sprintf("http://a.com/%d", i)) {
+			t.Fatalf("The key %d should be contained.", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if filter.Contains(fmt.Sprintf("http://b.com/%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > n/20 {
+		t.Errorf("Too many false positives: %d/%d.", falsePositives, n)
+	}
+	if filter.MemoryUsage() == 0 {
+		t.Error("The memory usage should not be 0.")
+	}
+}
+
+func TestDiskDupeFilterReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dupefilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "seen.set")
+	filter, err := NewDiskDupeFilter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 超过初始槽位数的一半，触发扩容。
+	n := diskSetInitialSlots/2 + 10
+	for i := 0; i < n; i++ {
+		if filter.TestAndAdd(fmt.Sprintf("http://a.com/%d", i)) {
+			t.Fatalf("The key %d should be new.", i)
+		}
+	}
+	if !filter.TestAndAdd("http://a.com/0") {
+		t.Fatal("The key 0 should have been added.")
+	}
+	filter.(*diskDupeFilter).Close()
+
+	filter, err = NewDiskDupeFilter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer filter.(*diskDupeFilter).Close()
+	if filter.Count() != uint64(n) {
+		t.Fatalf("Count %d after reload, expected %d.", filter.Count(), n)
+	}
+	if !filter.Contains(fmt.Sprintf("http://a.com/%d", n-1)) || filter.Contains("http://b.com/") {
+		t.Error("Unexpected membership after reload.")
+	}
+}
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"bufio"
+	"chaoshen.com/crawlergo/crawler/basic"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 爬取边界目录中的文件名。
+const (
+	frontierRequestFile = "requests.log"
+	frontierSeenFile    = "seen.log"
+	frontierDomainFile  = "domains.log"
+)
+
+// 只追加写入的行日志，用于持久化已见URL与许可域名。
+type lineLog struct {
+	sync.Mutex
+	file *os.File
+}
+
+// 打开行日志，并将其中已有的行逐行交给replay处理，避免一次性读入内存。
+func openLineLog(path string, replay func(line string)) (*lineLog, error) {
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				replay(line)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &lineLog{file: file}, nil
+}
+
+func (log *lineLog) Append(line string) error {
+	if log == nil {
+		return nil
+	}
+	log.Lock()
+	defer log.Unlock()
+	if log.file == nil {
+		return errors.New("The line log has been closed.")
+	}
+	_, err := log.file.WriteString(line + "\n")
+	return err
+}
+
+func (log *lineLog) Close() error {
+	if log == nil {
+		return nil
+	}
+	log.Lock()
+	defer log.Unlock()
+	if log.file == nil {
+		return nil
+	}
+	err := log.file.Close()
+	log.file = nil
+	return err
+}
+
+// 打开持久化的爬取边界，恢复请求缓存、已见URL与许可域名。
+func (sched *schedulerImpl) openFrontier() error {
+	dir := sched.frontierDir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	reqCache, err := basic.NewDiskRequestCache(filepath.Join(dir, frontierRequestFile), sched.strategy)
+	if err != nil {
+		return err
+	}
+	// 基于磁盘的去重过滤器自身即已持久化，无需再记录已见URL。
+	var seenLog *lineLog
+	if _, ok := sched.dupeFilter.(*diskDupeFilter); !ok {
+		seenLog, err = openLineLog(filepath.Join(dir, frontierSeenFile), func(key string) {
+			sched.dupeFilter.TestAndAdd(key)
+		})
+		if err != nil {
+			reqCache.Close()
+			return err
+		}
+	}
+	domainLog, err := openLineLog(filepath.Join(dir, frontierDomainFile), func(domain string) {
+		sched.acceptDomain[domain] = struct{}{}
+	})
+	if err != nil {
+		reqCache.Close()
+		seenLog.Close()
+		return err
+	}
+	sched.reqCache = reqCache
+	if seenLog != nil {
+		sched.dupeFilter = newLoggedDupeFilter(sched.dupeFilter, seenLog)
+	}
+	sched.seenLog = seenLog
+	sched.domainLog = domainLog
+	return nil
+}
+
+// 关闭持久化的爬取边界。
+func (sched *schedulerImpl) closeFrontier() {
+	sched.seenLog.Close()
+	sched.domainLog.Close()
+}
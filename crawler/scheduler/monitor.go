@@ -60,7 +60,8 @@ func checkStatus(
 			if scheduler.Status() == SCHEDULER_STATUS_CLOSED {
 				return
 			}
-			if scheduler.Idle() {
+			// 暂停的调度器不会产生新的请求，不能视为空闲。
+			if scheduler.Status() != SCHEDULER_STATUS_PAUSED && scheduler.Idle() {
 				var result string
 				if err := scheduler.Stop(); err == nil {
 					result = "success"
@@ -76,7 +77,8 @@ func checkStatus(
 }
 
 func waitForSchedulerStart(scheduler Scheduler) {
-	for scheduler.Status() != SCHEDULER_STATUS_RUNNING {
+	for scheduler.Status() != SCHEDULER_STATUS_RUNNING &&
+		scheduler.Status() != SCHEDULER_STATUS_PAUSED {
 		time.Sleep(time.Millisecond)
 	}
 }
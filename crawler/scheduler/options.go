@@ -0,0 +1,235 @@
+package scheduler
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/downloader"
+	"chaoshen.com/crawlergo/crawler/proxy"
+	"chaoshen.com/crawlergo/crawler/util"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 调度器的可选项，在NewScheduler创建各组件之前应用。
+type SchedOption func(sched *schedulerImpl) error
+
+// 将爬取边界（请求缓存、已见URL与许可域名）持久化到指定目录，
+// 以便进程退出后通过Restore继续爬取。
+func WithFrontierDir(dir string) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if dir == "" {
+			return errors.New("The frontier directory can not be empty.")
+		}
+		sched.frontierDir = dir
+		return nil
+	}
+}
+
+// 设置按主机的礼貌爬取限制（最小间隔、最大并发数），请求在各主机间轮询发送。
+// 默认按主域名区分主机且不限制间隔与并发数。
+func WithPoliteness(config basic.PolitenessConfig) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if err := config.IsValid(); err != nil {
+			return err
+		}
+		sched.politeness = &config
+		return nil
+	}
+}
+
+// 遵守robots.txt：按userAgent匹配规则组，拒绝的请求发送到错误通道，
+// 并将Crawl-delay作为对应主机的最小间隔。robots.txt缓存ttl时间，ttl为0时缓存一天。
+func WithRobots(userAgent string, ttl time.Duration) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if strings.TrimSpace(userAgent) == "" {
+			return errors.New("The robots user-agent can not be empty.")
+		}
+		sched.robotsAgent = userAgent
+		sched.robotsTTL = ttl
+		return nil
+	}
+}
+
+// 设置请求去重过滤器，默认使用基于map的过滤器。
+func WithDupeFilter(filter DupeFilter) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if filter == nil {
+			return errors.New("The dupe filter can not be nil.")
+		}
+		sched.dupeFilter = filter
+		return nil
+	}
+}
+
+// 设置去重前使用的URL规范化器，默认去除util.DefaultStripParams中的参数。
+func WithCanonicalizer(canonicalizer *util.URLCanonicalizer) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if canonicalizer == nil {
+			return errors.New("The URL canonicalizer can not be nil.")
+		}
+		sched.canonicalizer = canonicalizer
+		return nil
+	}
+}
+
+// 设置爬取策略，例如basic.BFSStrategy、basic.DFSStrategy或basic.BestFirstStrategy，
+// 请求缓存按策略计算的得分从高到低取出请求。默认先进先出。
+func WithCrawlStrategy(strategy basic.ScoreFunc) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if strategy == nil {
+			return errors.New("The crawl strategy can not be nil.")
+		}
+		sched.strategy = strategy
+		return nil
+	}
+}
+
+// 种子的主域名不自动加入许可域名，许可域名需通过AddPermitDomain设置。
+func WithoutSeedDomains() SchedOption {
+	return func(sched *schedulerImpl) error {
+		sched.noSeedDomains = true
+		return nil
+	}
+}
+
+// 设置下载的重试策略，例如downloader.NewRetryPolicy创建的指数退避策略。
+// 需要重试的请求会记录尝试次数并直接放回请求缓存，默认不重试。
+func WithRetryPolicy(policy downloader.RetryPolicy) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if policy == nil {
+			return errors.New("The retry policy can not be nil.")
+		}
+		sched.retryPolicy = policy
+		return nil
+	}
+}
+
+// 设置下载限制：响应体的大小上限及超限时截断或拒绝、允许的内容类型、
+// 需要先以HEAD请求探测的扩展名。被拒绝的响应不会交给分析器，
+// 而是以basic.CrawlerError的形式发送到错误通道。robots.txt的获取不受此限制。
+func WithDownloadLimits(limits basic.DownloadLimitConfig) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if err := limits.IsValid(); err != nil {
+			return err
+		}
+		sched.downloadLimits = &limits
+		return nil
+	}
+}
+
+// 启用HTTP条件请求缓存，例如使用downloader.NewFileResponseStore创建的本地存储。
+// 再次爬取时发送If-None-Match与If-Modified-Since，服务器返回304时以缓存的响应代替，
+// 其分析得到的条目带有basic.ITEM_NOT_MODIFIED_KEY标记。
+func WithHTTPCache(store downloader.ResponseStore) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if store == nil {
+			return errors.New("The http cache store can not be nil.")
+		}
+		sched.httpCache = store
+		return nil
+	}
+}
+
+// 设置所有网页下载器共享的Cookie容器，例如downloader.NewSessionJar创建的容器，
+// 可以先用config.SeedCookies预置配置中的Cookie。调度器停止时会保存该容器。
+func WithCookieJar(jar downloader.SessionJar) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if jar == nil {
+			return errors.New("The cookie jar can not be nil.")
+		}
+		sched.cookieJar = jar
+		return nil
+	}
+}
+
+// 设置所有网页下载器共享的代理池，例如proxy.NewPool或proxy.NewPoolWithHealthCheck创建的代理池。
+// 每个请求都由代理池选择代理，网络错误与异常的状态码会计入代理的失败次数。
+func WithProxyPool(pool proxy.Pool) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if pool == nil {
+			return errors.New("The proxy pool can not be nil.")
+		}
+		sched.proxyPool = pool
+		return nil
+	}
+}
+
+// 注册网页下载器中间件，按注册的顺序处理请求，按相反的顺序处理响应与错误。
+// 中间件位于HTTP缓存、代理池等功能之外，丢弃与重新调度的请求不会发送到错误通道。
+func WithDownloaderMiddlewares(middlewares ...downloader.Middleware) SchedOption {
+	return func(sched *schedulerImpl) error {
+		for _, mw := range middlewares {
+			if mw == nil {
+				return errors.New("The downloader middleware can not be nil.")
+			}
+		}
+		sched.middlewares = append(sched.middlewares, middlewares...)
+		return nil
+	}
+}
+
+// 注册URL协议的网页下载器，例如自定义协议或替换内置的file与data协议下载器。
+// 该下载器由所有下载器共享，必须可以并发使用。未注册的协议的请求会被忽略，
+// 从http与https页面分析得到的非http协议的链接也总是被忽略。
+func WithSchemeFetcher(scheme string, fetcher downloader.PageDownloader) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if scheme == "" || fetcher == nil {
+			return errors.New("The scheme and fetcher can not be empty.")
+		}
+		if downloader.IsHTTPScheme(scheme) {
+			return fmt.Errorf("The scheme '%s' is built in.", scheme)
+		}
+		if sched.schemeFetchers == nil {
+			sched.schemeFetchers = map[string]downloader.PageDownloader{}
+		}
+		sched.schemeFetchers[strings.ToLower(scheme)] = fetcher
+		return nil
+	}
+}
+
+// 将下载的每一对HTTP请求与响应写入dir中的WARC文件（ISO 28500），每条记录单独以gzip压缩，
+// 文件超过maxSize字节后轮换，每个文件以描述爬取配置的warcinfo记录开头。
+// 因下载限制被拒绝的响应与下载失败的请求同样写入，详见downloader.NewWARCMiddleware。
+func WithWARC(dir string, prefix string, maxSize int64) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if dir == "" || prefix == "" {
+			return errors.New("The warc directory and prefix can not be empty.")
+		}
+		if maxSize <= 0 {
+			return errors.New("The max size of warc file must be positive.")
+		}
+		sched.warcConfig = &warcConfig{dir: dir, prefix: prefix, maxSize: maxSize}
+		return nil
+	}
+}
+
+// 以回放模式运行：所有请求都从存档中读取响应并交给分析器与条目处理管道，不访问网络，
+// 例如以downloader.NewWARCStore读取WARC文件，或以downloader.NewFileResponseStore读取HTTP缓存。
+// 分析得到的链接同样在存档中查找，存档中没有的URL以basic.ARCHIVE_MISS_ERROR类型的错误发送到错误通道。
+// 存档中的重定向响应按WithRedirects设置的方式跟随或加入请求缓存。
+// 回放时不检查robots.txt，HTTP缓存、代理池与Cookie容器也不起作用。
+func WithReplay(store downloader.ResponseStore) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if store == nil {
+			return errors.New("The replay store can not be nil.")
+		}
+		sched.replayStore = store
+		return nil
+	}
+}
+
+// 设置重定向的处理方式。默认跟随最多downloader.DefaultMaxRedirects次重定向，
+// 每一次重定向的目标都需在许可域名内，否则以basic.REDIRECT_ERROR类型的错误发送到错误通道。
+// queue为true时不跟随重定向，而将其目标作为新请求加入请求缓存，
+// 请求记录已经过的重定向次数，超过maxRedirects的重定向同样被拒绝。
+func WithRedirects(maxRedirects int, queue bool) SchedOption {
+	return func(sched *schedulerImpl) error {
+		if maxRedirects < 0 {
+			return errors.New("The max redirects can not be negative.")
+		}
+		sched.maxRedirects = maxRedirects
+		sched.queueRedirects = queue
+		return nil
+	}
+}
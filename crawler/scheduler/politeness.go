@@ -0,0 +1,305 @@
+package scheduler
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/downloader"
+	"chaoshen.com/crawlergo/crawler/util"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 单个主机的调度状态，主机没有待发送与正在下载的请求且已过最小间隔后即被移除。
+type hostState struct {
+	queue        *basic.ScoredQueue // 等待发送的请求，按请求缓存计算的得分排序。
+	inFlight     uint32             // 正在下载的请求数。
+	lastDispatch time.Time          // 上一次发送请求的时间。
+	crawlDelay   time.Duration      // 由robots.txt声明的爬取间隔。
+	// 各源（协议与主机）的robots.txt是否已解析，值为false表示正在获取。
+	origins map[string]bool
+}
+
+// 按主机限流的请求调度器，位于请求缓存与请求通道之间。
+// 请求先从请求缓存预取到各主机的队列中，再在主机间轮询发送，
+// 每个主机都需满足最小间隔与最大并发数的限制。各主机的队列与请求缓存一样按得分排序，
+// 预取之后才取出的高分请求不会排在同一主机已预取的低分请求之后。
+// 只有当前可以发送的主机的请求占用预取的名额，受最小间隔或最大并发数限制的主机的请求
+// 以及尚未到最早发送时间的重试请求都另行存放，以免某个主机的请求占满预取上限，
+// 使请求缓存中其他主机的请求无法取出。
+type hostThrottle struct {
+	sync.Mutex
+	config   basic.PolitenessConfig
+	hosts    map[string]*hostState
+	ring     []string                 // 主机的轮询顺序。
+	next     int                      // 下一次轮询的起始位置。
+	buffered int                      // 已预取到各主机队列但尚未发送的请求数，包括受限的主机。
+	waiting  []*basic.DownloadRequest // 等待最早发送时间的重试请求。
+	// 获取请求所在主机的robots.txt，完成后应调用Resolved。为nil时不等待robots.txt。
+	resolve func(req *basic.DownloadRequest)
+}
+
+func newHostThrottle(config basic.PolitenessConfig) *hostThrottle {
+	return &hostThrottle{
+		config: config,
+		hosts:  make(map[string]*hostState),
+	}
+}
+
+// 设置获取robots.txt的函数。设置后，主机在其robots.txt解析之前不会发送请求，
+// 使发往主机的首个请求就遵守其声明的爬取间隔。resolve会在新的协程中调用。
+func (ht *hostThrottle) SetResolver(resolve func(req *basic.DownloadRequest)) {
+	ht.Lock()
+	defer ht.Unlock()
+	ht.resolve = resolve
+}
+
+// 获得请求对应的主机标识。
+func (ht *hostThrottle) hostKey(req *basic.DownloadRequest) string {
+	httpReq := req.HttpReq()
+	if httpReq == nil || httpReq.URL == nil {
+		return ""
+	}
+	host := strings.ToLower(httpReq.URL.Hostname())
+	if ht.config.HostKeyMode() == basic.HOST_KEY_PRIMARY_DOMAIN {
+		if domain, err := util.GetPrimaryDomain(host); err == nil {
+			return domain
+		}
+	}
+	return host
+}
+
+// 获得还可以预取的请求数，即预取上限减去当前可以发送的主机已预取的请求数。
+// 受限主机的请求与等待重试的请求不计在内。
+func (ht *hostThrottle) Room(now time.Time) int {
+	ht.Lock()
+	defer ht.Unlock()
+	room := int(ht.config.MaxBuffered())
+	for key, state := range ht.hosts {
+		if ht.ready(key, state, now) {
+			room -= state.queue.Len()
+		}
+	}
+	if room < 0 {
+		return 0
+	}
+	return room
+}
+
+// 从请求缓存预取请求，直到没有预取的名额或请求缓存为空。
+// 受限主机的请求不占用预取的名额，因此其他主机的请求总能被取出。
+func (ht *hostThrottle) Prefetch(cache basic.RequestCache, now time.Time) {
+	for room := ht.Room(now); room > 0; {
+		req := cache.Get()
+		if req == nil {
+			return
+		}
+		if ht.Add(req, now) {
+			room--
+		}
+	}
+}
+
+// 将请求放入对应主机的队列，带有最早发送时间的请求先放入等待列表。
+// 请求占用预取的名额时返回true，即请求所在主机当前可以发送。
+func (ht *hostThrottle) Add(req *basic.DownloadRequest, now time.Time) bool {
+	ht.Lock()
+	defer ht.Unlock()
+	if !req.NotBefore().IsZero() {
+		ht.waiting = append(ht.waiting, req)
+		return false
+	}
+	key, state := ht.enqueue(req)
+	return ht.ready(key, state, now)
+}
+
+// 将请求放入对应主机的队列。
+func (ht *hostThrottle) enqueue(req *basic.DownloadRequest) (string, *hostState) {
+	key := ht.hostKey(req)
+	state, ok := ht.hosts[key]
+	if !ok {
+		state = &hostState{queue: basic.NewScoredQueue(), origins: make(map[string]bool)}
+		ht.hosts[key] = state
+		ht.ring = append(ht.ring, key)
+	}
+	state.queue.Push(req)
+	ht.buffered++
+	return key, state
+}
+
+// 轮询各主机，取出一个满足限制的请求，没有可发送的请求时返回nil。
+// 等待重试的请求在其最早发送时间之前不会被取出。
+func (ht *hostThrottle) Next(now time.Time) *basic.DownloadRequest {
+	ht.Lock()
+	defer ht.Unlock()
+	ht.promote(now)
+	for i := 0; i < len(ht.ring); i++ {
+		index := (ht.next + i) % len(ht.ring)
+		key := ht.ring[index]
+		state := ht.hosts[key]
+		if state.queue.Len() == 0 || !ht.ready(key, state, now) {
+			continue
+		}
+		req := state.queue.Pop()
+		state.inFlight++
+		state.lastDispatch = now
+		ht.buffered--
+		ht.next = index + 1
+		ht.cleanup(now)
+		return req
+	}
+	ht.cleanup(now)
+	return nil
+}
+
+// 将已到最早发送时间的等待请求放入对应主机的队列。
+func (ht *hostThrottle) promote(now time.Time) {
+	waiting := ht.waiting[:0]
+	for _, req := range ht.waiting {
+		if req.NotBefore().After(now) {
+			waiting = append(waiting, req)
+			continue
+		}
+		ht.enqueue(req)
+	}
+	for i := len(waiting); i < len(ht.waiting); i++ {
+		ht.waiting[i] = nil
+	}
+	ht.waiting = waiting
+}
+
+// 判断主机当前是否可以发送请求。
+// 队首请求所在源的robots.txt尚未解析时不可发送，并开始获取该robots.txt。
+func (ht *hostThrottle) ready(key string, state *hostState, now time.Time) bool {
+	limit := ht.config.HostLimit(key)
+	if limit.MaxInFlight > 0 && state.inFlight >= limit.MaxInFlight {
+		return false
+	}
+	if head := state.queue.Peek(); head != nil && !ht.resolved(state, head) {
+		return false
+	}
+	return now.Sub(state.lastDispatch) >= ht.delay(key, state)
+}
+
+// 判断请求所在源的robots.txt是否已解析，未开始获取时开始获取。
+// 主机被移除后其解析结果随之丢弃，再次出现时重新获取（通常命中robots.txt检查器的缓存）。
+func (ht *hostThrottle) resolved(state *hostState, req *basic.DownloadRequest) bool {
+	origin := originKey(req)
+	if ht.resolve == nil || origin == "" {
+		return true
+	}
+	done, ok := state.origins[origin]
+	if !ok {
+		state.origins[origin] = false
+		go ht.resolve(req)
+	}
+	return done
+}
+
+// 告知请求所在源的robots.txt已解析，并设置其声明的爬取间隔。
+// 获取失败时同样应调用，请求发送后由下载前的检查拒绝。
+func (ht *hostThrottle) Resolved(req *basic.DownloadRequest, delay time.Duration) {
+	key := ht.hostKey(req)
+	origin := originKey(req)
+	ht.Lock()
+	defer ht.Unlock()
+	state, ok := ht.hosts[key]
+	if !ok {
+		return
+	}
+	ht.raiseCrawlDelay(state, delay)
+	if origin != "" {
+		state.origins[origin] = true
+	}
+}
+
+// 获得请求的源，即robots.txt的作用范围，非http协议的请求返回空字符串。
+func originKey(req *basic.DownloadRequest) string {
+	httpReq := req.HttpReq()
+	if httpReq == nil || httpReq.URL == nil {
+		return ""
+	}
+	if !downloader.IsHTTPScheme(httpReq.URL.Scheme) {
+		return ""
+	}
+	return strings.ToLower(httpReq.URL.Scheme + "://" + httpReq.URL.Host)
+}
+
+// 获得主机的最小间隔，取配置与robots.txt声明中的较大者。
+func (ht *hostThrottle) delay(key string, state *hostState) time.Duration {
+	delay := ht.config.HostLimit(key).Delay
+	if state.crawlDelay > delay {
+		return state.crawlDelay
+	}
+	return delay
+}
+
+// 设置请求所在主机由robots.txt声明的爬取间隔，主机已被移除时忽略。
+// 按主域名区分主机时，同一主域名下各主机的爬取间隔取最大值。
+func (ht *hostThrottle) SetCrawlDelay(req *basic.DownloadRequest, delay time.Duration) {
+	key := ht.hostKey(req)
+	ht.Lock()
+	defer ht.Unlock()
+	if state, ok := ht.hosts[key]; ok {
+		ht.raiseCrawlDelay(state, delay)
+	}
+}
+
+func (ht *hostThrottle) raiseCrawlDelay(state *hostState, delay time.Duration) {
+	if delay > state.crawlDelay {
+		state.crawlDelay = delay
+	}
+}
+
+// 移除没有待发送与正在下载的请求、且已过最小间隔的主机，连同其爬取间隔与robots.txt的解析状态，
+// 使限流器占用的内存只与活跃的主机数有关。
+func (ht *hostThrottle) cleanup(now time.Time) {
+	ring := ht.ring[:0]
+	for i, key := range ht.ring {
+		state := ht.hosts[key]
+		if state.queue.Len() == 0 && state.inFlight == 0 &&
+			now.Sub(state.lastDispatch) >= ht.delay(key, state) {
+			delete(ht.hosts, key)
+			if i < ht.next {
+				ht.next--
+			}
+			continue
+		}
+		ring = append(ring, key)
+	}
+	ht.ring = ring
+	if ht.next >= len(ht.ring) {
+		ht.next = 0
+	}
+}
+
+// 告知请求已下载完毕。
+func (ht *hostThrottle) Done(req *basic.DownloadRequest) {
+	key := ht.hostKey(req)
+	ht.Lock()
+	defer ht.Unlock()
+	if state, ok := ht.hosts[key]; ok && state.inFlight > 0 {
+		state.inFlight--
+	}
+}
+
+// 获得已预取但尚未发送的请求数，包括等待重试的请求。
+func (ht *hostThrottle) Buffered() int {
+	ht.Lock()
+	defer ht.Unlock()
+	return ht.buffered + len(ht.waiting)
+}
+
+// 摘要信息模板。
+var throttleSummaryTemplate = "config: %s, hosts: %d, buffered: %d, waiting: %d, inFlight: %d"
+
+func (ht *hostThrottle) Summary() string {
+	ht.Lock()
+	defer ht.Unlock()
+	var inFlight uint32
+	for _, state := range ht.hosts {
+		inFlight += state.inFlight
+	}
+	return fmt.Sprintf(throttleSummaryTemplate,
+		ht.config.Summary(), len(ht.hosts), ht.buffered, len(ht.waiting), inFlight)
+}
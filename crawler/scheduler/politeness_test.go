@@ -0,0 +1,234 @@
+package scheduler
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func newThrottleRequest(t *testing.T, url string) *basic.DownloadRequest {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return basic.NewDownloadRequest(0, req, 1)
+}
+
+func TestHostThrottleRoundRobin(t *testing.T) {
+	config := basic.NewPolitenessConfig(basic.HOST_KEY_PRIMARY_DOMAIN, time.Second, 0)
+	throttle := newHostThrottle(config)
+	now := time.Now()
+	for _, url := range []string{"http://a.com/1", "http://www.a.com/2", "http://b.com/1", "http://c.com/1"} {
+		throttle.Add(newThrottleRequest(t, url), now)
+	}
+	hosts := make([]string, 0)
+	for req := throttle.Next(now); req != nil; req = throttle.Next(now) {
+		hosts = append(hosts, req.HttpReq().URL.Host)
+	}
+	// a.com的第二个请求需要等待最小间隔。
+	if len(hosts) != 3 || hosts[0] != "a.com" || hosts[1] != "b.com" || hosts[2] != "c.com" {
+		t.Fatalf("Unexpected dispatch order %v.", hosts)
+	}
+	if req := throttle.Next(now.Add(time.Second)); req == nil || req.HttpReq().URL.Host != "www.a.com" {
+		t.Fatalf("Get %v after the delay, expected www.a.com.", req)
+	}
+	if throttle.Buffered() != 0 {
+		t.Errorf("Buffered %d, expected 0.", throttle.Buffered())
+	}
+}
+
+func TestHostThrottleMaxInFlight(t *testing.T) {
+	config := basic.NewPolitenessConfig(basic.HOST_KEY_EXACT_HOST, 0, 1)
+	config.SetHostLimit("b.com", basic.HostLimit{MaxInFlight: 2})
+	throttle := newHostThrottle(config)
+	now := time.Now()
+	for _, url := range []string{"http://a.com/1", "http://a.com/2", "http://b.com/1", "http://b.com/2"} {
+		throttle.Add(newThrottleRequest(t, url), now)
+	}
+	first := throttle.Next(now)
+	count := 1
+	for req := throttle.Next(now); req != nil; req = throttle.Next(now) {
+		count++
+	}
+	if count != 3 {
+		t.Fatalf("Dispatched %d requests, expected 3.", count)
+	}
+	throttle.Done(first)
+	if req := throttle.Next(now); req == nil || req.HttpReq().URL.String() != "http://a.com/2" {
+		t.Fatalf("Get %v after done, expected http://a.com/2.", req)
+	}
+}
+
+func TestHostThrottleNotBefore(t *testing.T) {
+	config := basic.NewPolitenessConfig(basic.HOST_KEY_EXACT_HOST, 0, 0)
+	throttle := newHostThrottle(config)
+	now := time.Now()
+	throttle.Add(newThrottleRequest(t, "http://a.com/1").NextAttempt(now.Add(time.Minute)), now)
+	throttle.Add(newThrottleRequest(t, "http://a.com/2"), now)
+	if req := throttle.Next(now); req == nil || req.HttpReq().URL.Path != "/2" {
+		t.Fatalf("Get %v, expected the request that is not delayed.", req)
+	}
+	if req := throttle.Next(now); req != nil {
+		t.Fatalf("Get %v before the retry time, expected nil.", req)
+	}
+	if req := throttle.Next(now.Add(time.Minute)); req == nil || req.Attempt() != 1 {
+		t.Fatalf("Get %v after the retry time, expected the retried request.", req)
+	}
+}
+
+func TestHostThrottleWaitingNotBuffered(t *testing.T) {
+	config := basic.NewPolitenessConfig(basic.HOST_KEY_EXACT_HOST, 0, 0)
+	config.SetMaxBuffered(1)
+	throttle := newHostThrottle(config)
+	now := time.Now()
+	throttle.Add(newThrottleRequest(t, "http://a.com/1").NextAttempt(now.Add(time.Minute)), now)
+	throttle.Add(newThrottleRequest(t, "http://b.com/1").NextAttempt(now.Add(time.Minute)), now)
+	if room := throttle.Room(now); room != 1 {
+		t.Fatalf("Room %d, the requests waiting for retry should not fill the buffer.", room)
+	}
+	if throttle.Buffered() != 2 {
+		t.Fatalf("Buffered %d, expected 2.", throttle.Buffered())
+	}
+	if !throttle.Add(newThrottleRequest(t, "http://a.com/2"), now) {
+		t.Fatal("The request of a ready host should take the buffer.")
+	}
+	if room := throttle.Room(now); room != 0 {
+		t.Fatalf("Room %d, the buffer should be full.", room)
+	}
+	if req := throttle.Next(now); req == nil || req.HttpReq().URL.String() != "http://a.com/2" {
+		t.Fatalf("Get %v, expected the request that is not delayed.", req)
+	}
+	if req := throttle.Next(now); req != nil {
+		t.Fatalf("Get %v before the retry time, expected nil.", req)
+	}
+	later := now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		if req := throttle.Next(later); req == nil || req.Attempt() != 1 {
+			t.Fatalf("Get %v after the retry time, expected a retried request.", req)
+		}
+	}
+	if throttle.Buffered() != 0 {
+		t.Errorf("Buffered %d, expected 0.", throttle.Buffered())
+	}
+}
+
+func TestHostThrottlePrefetchBusyHost(t *testing.T) {
+	delay := time.Second
+	config := basic.NewPolitenessConfig(basic.HOST_KEY_EXACT_HOST, delay, 0)
+	config.SetMaxBuffered(10)
+	throttle := newHostThrottle(config)
+	cache := basic.NewPriorityRequestCache(0, nil)
+	for i := 0; i < 25; i++ {
+		if err := cache.Put(newThrottleRequest(t, fmt.Sprintf("http://a.com/%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cache.Put(newThrottleRequest(t, "http://b.com/1")); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟调度循环：每隔10毫秒预取一次，再取出所有可以发送的请求。
+	start := time.Now()
+	for now := start; now.Sub(start) < delay; now = now.Add(10 * time.Millisecond) {
+		throttle.Prefetch(cache, now)
+		for req := throttle.Next(now); req != nil; req = throttle.Next(now) {
+			if req.HttpReq().URL.Host == "b.com" {
+				return
+			}
+		}
+	}
+	t.Fatalf("b.com is not served within %s. (buffered=%d)", delay, throttle.Buffered())
+}
+
+func TestHostThrottleWaitsForRobots(t *testing.T) {
+	config := basic.NewPolitenessConfig(basic.HOST_KEY_EXACT_HOST, 0, 0)
+	throttle := newHostThrottle(config)
+	resolving := make(chan *basic.DownloadRequest, 2)
+	throttle.SetResolver(func(req *basic.DownloadRequest) {
+		resolving <- req
+	})
+	now := time.Now()
+	for _, url := range []string{"http://a.com/1", "http://a.com/2"} {
+		if throttle.Add(newThrottleRequest(t, url), now) {
+			t.Fatalf("The request %s should not take the buffer before robots.txt is resolved.", url)
+		}
+	}
+	if req := throttle.Next(now); req != nil {
+		t.Fatalf("Get %v before robots.txt is resolved, expected nil.", req)
+	}
+	req := <-resolving
+	select {
+	case other := <-resolving:
+		t.Fatalf("robots.txt of %s is fetched twice.", other.HttpReq().URL.Host)
+	default:
+	}
+	throttle.Resolved(req, time.Second)
+	if req := throttle.Next(now); req == nil || req.HttpReq().URL.Path != "/1" {
+		t.Fatalf("Get %v after robots.txt is resolved, expected http://a.com/1.", req)
+	}
+	// 首个请求之后即遵守robots.txt声明的爬取间隔。
+	if req := throttle.Next(now); req != nil {
+		t.Fatalf("Get %v within the crawl delay, expected nil.", req)
+	}
+	if req := throttle.Next(now.Add(time.Second)); req == nil || req.HttpReq().URL.Path != "/2" {
+		t.Fatalf("Get %v after the crawl delay, expected http://a.com/2.", req)
+	}
+}
+
+func TestHostThrottlePrunesIdleHosts(t *testing.T) {
+	config := basic.NewPolitenessConfig(basic.HOST_KEY_EXACT_HOST, 0, 0)
+	throttle := newHostThrottle(config)
+	throttle.SetResolver(func(req *basic.DownloadRequest) {
+		throttle.Resolved(req, time.Second)
+	})
+	now := time.Now()
+	req := newThrottleRequest(t, "http://a.com/1")
+	throttle.Add(req, now)
+	waitFor(t, time.Second, "robots.txt to be resolved", func() bool {
+		return throttle.Room(now) == int(config.MaxBuffered())-1
+	})
+	if next := throttle.Next(now); next != req {
+		t.Fatalf("Get %v, expected %v.", next, req)
+	}
+	throttle.Done(req)
+	// 爬取间隔之内主机仍被保留，以免忘记其爬取间隔。
+	throttle.Next(now.Add(time.Second / 2))
+	if len(throttle.hosts) != 1 {
+		t.Fatalf("The host within its crawl delay should be kept, got %d hosts.", len(throttle.hosts))
+	}
+	throttle.Next(now.Add(time.Second))
+	if len(throttle.hosts) != 0 || len(throttle.ring) != 0 {
+		t.Fatalf("The idle host should be pruned, got %d hosts.", len(throttle.hosts))
+	}
+}
+
+func TestHostThrottleKeepsPriority(t *testing.T) {
+	config := basic.NewPolitenessConfig(basic.HOST_KEY_EXACT_HOST, time.Second, 0)
+	throttle := newHostThrottle(config)
+	score := basic.BestFirstStrategy([]basic.ScoreRule{{Pattern: regexp.MustCompile("/high"), Score: 10}}, 0, 0)
+	cache := basic.NewPriorityRequestCache(0, score)
+	for _, url := range []string{"http://a.com/low1", "http://a.com/low2", "http://b.com/low1"} {
+		cache.Put(newThrottleRequest(t, url))
+	}
+	now := time.Now()
+	throttle.Prefetch(cache, now)
+	dispatched := make([]string, 0)
+	for req := throttle.Next(now); req != nil; req = throttle.Next(now) {
+		dispatched = append(dispatched, req.HttpReq().URL.String())
+	}
+	// 预取之后才放入请求缓存的高分请求，排在同一主机已预取的低分请求之前。
+	for _, url := range []string{"http://b.com/low2", "http://a.com/high", "http://b.com/high"} {
+		cache.Put(newThrottleRequest(t, url))
+	}
+	later := now.Add(time.Second)
+	throttle.Prefetch(cache, later)
+	for req := throttle.Next(later); req != nil; req = throttle.Next(later) {
+		dispatched = append(dispatched, req.HttpReq().URL.String())
+	}
+	expected := []string{"http://a.com/low1", "http://b.com/low1", "http://a.com/high", "http://b.com/high"}
+	if fmt.Sprint(dispatched) != fmt.Sprint(expected) {
+		t.Fatalf("Dispatched %v, expected %v.", dispatched, expected)
+	}
+}
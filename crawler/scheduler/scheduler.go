@@ -5,11 +5,17 @@ import (
 	"chaoshen.com/crawlergo/crawler/downloader"
 	"chaoshen.com/crawlergo/crawler/pageParser"
 	"chaoshen.com/crawlergo/crawler/pipeline"
+	"chaoshen.com/crawlergo/crawler/proxy"
+	"chaoshen.com/crawlergo/crawler/robots"
 	"chaoshen.com/crawlergo/crawler/util"
+	"chaoshen.com/crawlergo/crawler/warc"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/astaxie/beego/logs"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -23,6 +29,7 @@ const (
 	SCHEDULER_STATUS_RUNNING
 	SCHEDULER_STATUS_CLOSED
 	SCHEDULER_STATUS_FATAL_ERROR
+	SCHEDULER_STATUS_PAUSED
 )
 
 const (
@@ -30,27 +37,36 @@ const (
 	PARSER_CODE       = "parser"
 	ITEMPIPELINE_CODE = "item_pipeline"
 	SCHEDULER_CODE    = "scheduler"
+	FRONTIER_CODE     = "frontier"
+	ROBOTS_CODE       = "robots"
 )
 
 type Scheduler interface {
-	Start(initRequest *http.Request) error
+	Start(ctx context.Context, seeds ...*http.Request) error
+	Restore(ctx context.Context) error
 	Stop() error
+	Shutdown(timeout time.Duration) (ShutdownReport, error)
+	Pause() error
+	Resume() error
 	Status() uint
 	ErrorChan() <-chan error
 	Idle() bool
+	Enqueue(req *basic.DownloadRequest) error
 	AddPermitDomain(host string) error
 	Summary() SchedSummary
 }
 
 type schedulerImpl struct {
 	sync.RWMutex
-	mapLock 	   sync.RWMutex
+	seenLock       sync.Mutex // 使去重检查、放入请求缓存与记录已见成为一体。
 	channelConfig  basic.ChannelConfig
 	poolBaseConfig basic.PoolBaseConfig
 	crawMaxDepth   uint32
-	urlMap         map[string]bool
+	dupeFilter     DupeFilter
+	canonicalizer  *util.URLCanonicalizer
 	status         uint32
-	acceptDomain   map[string]struct{}
+	acceptDomain   map[string]struct{} // 许可的主域名，由RWMutex保护。
+	noSeedDomains  bool                // 种子的主域名不自动加入许可域名。
 	channelManager util.ChannelManager
 	stopSign       util.StopSign
 	dlPool         downloader.PageDownloaderPool
@@ -58,6 +74,39 @@ type schedulerImpl struct {
 	pageParsers    []pageParser.ParseResponse
 	itemPipeline   itemproc.ItemPipeline
 	reqCache       basic.RequestCache
+	frontierDir    string
+	strategy       basic.ScoreFunc
+	politeness     *basic.PolitenessConfig
+	throttle       *hostThrottle
+	robotsAgent    string
+	robotsTTL      time.Duration
+	robots         *robots.Checker
+	seenLog        *lineLog
+	domainLog      *lineLog
+	awaitingParse  sync.Map // 已发送到响应通道的响应到其请求的映射，分析完毕后才告知请求缓存该请求已完成。
+	ctx            context.Context    // 由Start传入的上下文派生，附加到每个请求上。
+	cancel         context.CancelFunc // 取消ctx，中止正在进行的下载与分析。
+	sendLock       sync.RWMutex       // 保护向通道的发送，关闭通道时需持有写锁。
+	stopped        chan struct{}      // 调度器停止时关闭，唤醒阻塞的发送方。
+	draining       uint32             // 是否正在优雅关闭。
+	downloading    int64              // 已发送到下载协程但尚未完成的下载数。
+	parsing        int64              // 已发送到响应通道但尚未分析完毕的响应数。
+	processing     int64              // 已发送到条目通道但尚未处理完毕的条目数。
+	skipped        uint64             // 优雅关闭期间放弃下载的请求数。
+	retryPolicy    downloader.RetryPolicy
+	downloadLimits *basic.DownloadLimitConfig
+	httpCache      downloader.ResponseStore
+	cookieJar      downloader.SessionJar // 所有网页下载器共享的Cookie容器。
+	proxyPool      proxy.Pool            // 所有网页下载器共享的代理池。
+	middlewares    []downloader.Middleware
+	schemeFetchers map[string]downloader.PageDownloader // 通过选项注册的协议下载器。
+	schemes        *downloader.SchemeRegistry           // URL协议到网页下载器的注册表。
+	warcConfig     *warcConfig                          // WARC归档的设置。
+	warcWriter     warc.Writer
+	replayStore    downloader.ResponseStore // 回放模式的存档。
+	timings        *hostTimings             // 按主机汇总的网络耗时。
+	maxRedirects   int                      // 最多跟随重定向的次数。
+	queueRedirects bool                     // 是否将重定向的目标作为新请求加入请求缓存，而不是直接跟随。
 }
 
 func NewScheduler(rawMaxDepth uint32,
@@ -65,7 +114,8 @@ func NewScheduler(rawMaxDepth uint32,
 	poolBaseConfig basic.PoolBaseConfig,
 	httpClientGenerator downloader.GenHttpClient,
 	pageParsers []pageParser.ParseResponse,
-	processor []itemproc.ProcessItem) (Scheduler, error) {
+	processor []itemproc.ProcessItem,
+	opts ...SchedOption) (Scheduler, error) {
 	//check the parameters
 	if rawMaxDepth == 0 ||
 		pageParsers == nil || len(pageParsers) == 0 ||
@@ -75,6 +125,13 @@ func NewScheduler(rawMaxDepth uint32,
 	scheduler := &schedulerImpl{}
 	atomic.StoreUint32(&(scheduler.status), uint32(SCHEDULER_STATUS_ALLOCATE))
 	scheduler.crawMaxDepth = rawMaxDepth
+	scheduler.maxRedirects = downloader.DefaultMaxRedirects
+	for _, opt := range opts {
+		if err := opt(scheduler); err != nil {
+			atomic.StoreUint32(&(scheduler.status), uint32(SCHEDULER_STATUS_FATAL_ERROR))
+			return nil, err
+		}
+	}
 	if err := channelConfig.IsValid(); err != nil {
 		atomic.StoreUint32(&(scheduler.status), uint32(SCHEDULER_STATUS_FATAL_ERROR))
 		return nil, err
@@ -89,12 +146,39 @@ func NewScheduler(rawMaxDepth uint32,
 
 	scheduler.channelManager = util.NewChannelManager(channelConfig)
 
-	dlPool, err := downloader.NewPageDownloaderPoolWithHttpClientGen(poolBaseConfig.PageDownloaderPoolSize(), httpClientGenerator)
+	if scheduler.canonicalizer == nil {
+		scheduler.canonicalizer = util.NewURLCanonicalizer(util.DefaultStripParams...)
+	}
+
+	if err := scheduler.initSchemes(); err != nil {
+		return nil, err
+	}
+	if err := scheduler.initArchive(); err != nil {
+		return nil, err
+	}
+
+	dlPool, err := downloader.NewPageDownloaderPoolWithGen(poolBaseConfig.PageDownloaderPoolSize(),
+		scheduler.genPageDownloader(httpClientGenerator))
+	if err != nil {
+		return nil, err
+	}
+	// robots.txt与网页经由相同的代理池与Cookie容器获取，但不受下载限制与缓存等功能的影响。
+	robotsPool, err := downloader.NewPageDownloaderPoolWithGen(poolBaseConfig.PageDownloaderPoolSize(),
+		scheduler.genRobotsDownloader(httpClientGenerator))
 	if err != nil {
 		return nil, err
 	}
 	scheduler.dlPool = dlPool
 
+	// 回放时不访问网络，也就无需遵守robots.txt。
+	if scheduler.robotsAgent != "" && scheduler.replayStore == nil {
+		checker, err := robots.NewChecker(scheduler.robotsAgent, robotsPool, scheduler.robotsTTL)
+		if err != nil {
+			return nil, err
+		}
+		scheduler.robots = checker
+	}
+
 	pageParserPool, err := pageParser.NewPageParserPool(poolBaseConfig.PageParserPoolSize(), func() pageParser.PageParser {
 		return pageParser.NewPageParser()
 	})
@@ -112,21 +196,91 @@ func NewScheduler(rawMaxDepth uint32,
 	scheduler.itemPipeline = itemPipeLine
 
 	scheduler.stopSign = util.NewStopSign()
+	scheduler.stopped = make(chan struct{})
+	scheduler.timings = newHostTimings()
 
-	scheduler.reqCache = basic.NewRequestCache(0)
 	scheduler.acceptDomain = make(map[string]struct{})
-	scheduler.urlMap = make(map[string]bool)
+	if scheduler.dupeFilter == nil {
+		scheduler.dupeFilter = NewMapDupeFilter()
+	}
+	if scheduler.politeness == nil {
+		politeness := basic.NewPolitenessConfig(basic.HOST_KEY_PRIMARY_DOMAIN, 0, 0)
+		scheduler.politeness = &politeness
+	}
+	scheduler.throttle = newHostThrottle(*scheduler.politeness)
+	if scheduler.robots != nil {
+		scheduler.throttle.SetResolver(scheduler.resolveRobots)
+	}
+	if scheduler.frontierDir != "" {
+		if err := scheduler.openFrontier(); err != nil {
+			return nil, err
+		}
+	} else {
+		scheduler.reqCache = basic.NewPriorityRequestCache(0, scheduler.strategy)
+	}
 
 	atomic.StoreUint32(&(scheduler.status), uint32(SCHEDULER_STATUS_READY))
 
 	return scheduler, nil
 }
 
-func (sched *schedulerImpl) Start(initRequest *http.Request) error {
-	if initRequest == nil {
-		return errors.New("The first request cannot be nil.")
+// 以种子请求开始爬取，种子的主域名默认加入许可域名。
+// 取消ctx会中止正在进行的下载与分析，并停止调度器。
+func (sched *schedulerImpl) Start(ctx context.Context, seeds ...*http.Request) error {
+	if ctx == nil {
+		return errors.New("The context cannot be nil.")
 	}
+	if len(seeds) == 0 {
+		return errors.New("The seed requests cannot be empty.")
+	}
+	for i, seed := range seeds {
+		if seed == nil || seed.URL == nil {
+			return fmt.Errorf("The seed request [%d] is invalid.", i)
+		}
+		if !sched.schemes.Supported(seed.URL.Scheme) {
+			return fmt.Errorf("The scheme '%s' of seed request [%d] is not supported. Supported schemes: %v",
+				seed.URL.Scheme, i, sched.schemes.Schemes())
+		}
+	}
+	if err := sched.checkStartable(); err != nil {
+		return err
+	}
+	if !sched.noSeedDomains {
+		for _, seed := range seeds {
+			if err := sched.addRequestDomain(seed); err != nil {
+				return fmt.Errorf("Add primary permit domain error. (seedUrl=%s)", seed.URL)
+			}
+		}
+	}
+	// 恢复爬取时，已经爬取过的种子请求不再重复下载。
+	for _, seed := range seeds {
+		if _, err := sched.putUnseen(basic.NewDownloadRequest(0, seed, 0)); err != nil {
+			return fmt.Errorf("Put the seed request into the request cache error: %s (seedUrl=%s)", err, seed.URL)
+		}
+	}
+	sched.start(ctx)
+	return nil
+}
 
+// 从持久化的爬取边界恢复上一次的爬取。
+func (sched *schedulerImpl) Restore(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("The context cannot be nil.")
+	}
+	if sched.frontierDir == "" {
+		return errors.New("The scheduler has no persistent frontier to restore.")
+	}
+	if sched.reqCache.Length() == 0 {
+		return errors.New("The persistent frontier has no pending request.")
+	}
+	if err := sched.checkStartable(); err != nil {
+		return err
+	}
+	sched.start(ctx)
+	return nil
+}
+
+func (sched *schedulerImpl) checkStartable() error {
 	status := atomic.LoadUint32(&sched.status)
 	switch status {
 	case SCHEDULER_STATUS_ALLOCATE:
@@ -139,23 +293,28 @@ func (sched *schedulerImpl) Start(initRequest *http.Request) error {
 		return errors.New("The scheduler has encountered a fatal error.")
 	case SCHEDULER_STATUS_STARTING:
 		return errors.New("The scheduler is already starting.")
+	case SCHEDULER_STATUS_PAUSED:
+		return errors.New("The scheduler has been started and is paused.")
 	}
+	return nil
+}
+
+func (sched *schedulerImpl) start(ctx context.Context) {
 	atomic.StoreUint32(&(sched.status), uint32(SCHEDULER_STATUS_STARTING))
 
+	sched.ctx, sched.cancel = context.WithCancel(ctx)
+	go func() {
+		<-sched.ctx.Done()
+		sched.Stop()
+	}()
+
 	sched.startDownloading()
 	sched.startPageParsing()
 	sched.startItemPipeLine()
 
-
-	if err := sched.addRequestDomain(initRequest); err != nil {
-		return errors.New("Add primary permit domain error.")
-	}
 	sched.startSchedule(10 * time.Millisecond)
 
 	atomic.StoreUint32(&(sched.status), uint32(SCHEDULER_STATUS_RUNNING))
-
-	sched.reqCache.Put(basic.NewDownloadRequest(0, initRequest, 0))
-	return nil
 }
 
 func (sched *schedulerImpl) ErrorChan() <-chan error {
@@ -167,6 +326,7 @@ func (sched *schedulerImpl) ErrorChan() <-chan error {
 
 func (sched *schedulerImpl) Idle() bool {
 	return sched.reqCache.Length() == 0 &&
+		sched.throttle.Buffered() == 0 &&
 		len(sched.getReqChan()) == 0 &&
 		len(sched.getRespChan()) == 0 &&
 		sched.dlPool.Used() == 0 &&
@@ -180,42 +340,94 @@ func (sched *schedulerImpl) AddPermitDomain(host string) error {
 		logs.Error("Add Request domain error: %s\n.", err)
 		return err
 	}
+	sched.Lock()
+	defer sched.Unlock()
 	if _, ok := sched.acceptDomain[domain]; !ok {
 		sched.acceptDomain[domain] = struct{}{}
+		sched.domainLog.Append(domain)
 	}
 	return nil
 }
 
 
 func (sched *schedulerImpl) Status() uint {
-	return uint(sched.status)
+	return uint(atomic.LoadUint32(&sched.status))
 }
 
 func (sched *schedulerImpl) Stop() error {
 	if ok := sched.stopSign.SignStop(); !ok {
 		return errors.New("The scheduler has been stoped.")
 	}
+	close(sched.stopped)
+	if sched.cancel != nil {
+		sched.cancel()
+	}
+	sched.sendLock.Lock()
 	sched.channelManager.Close()
+	sched.sendLock.Unlock()
 	sched.reqCache.Close()
+	sched.closeFrontier()
+	if closer, ok := sched.dupeFilter.(io.Closer); ok {
+		closer.Close()
+	}
+	if sched.warcWriter != nil {
+		if err := sched.warcWriter.Close(); err != nil {
+			logs.Warning("Close the warc writer error: %s", err)
+		}
+	}
+	if sched.cookieJar != nil {
+		if err := sched.cookieJar.Close(); err != nil {
+			logs.Warning("Save the cookie jar error: %s", err)
+		}
+	}
 	atomic.StoreUint32(&(sched.status), uint32(SCHEDULER_STATUS_CLOSED))
 
 	return nil
 }
 
+// 暂停调度：不再从请求缓存向请求通道发送请求，正在进行的下载、分析与条目处理照常完成。
+func (sched *schedulerImpl) Pause() error {
+	if sched.stopSign.IsSigned() {
+		return errors.New("The scheduler has been stoped.")
+	}
+	if !atomic.CompareAndSwapUint32(&sched.status, SCHEDULER_STATUS_RUNNING, SCHEDULER_STATUS_PAUSED) {
+		return errors.New("The scheduler is not running.")
+	}
+	return nil
+}
+
+// 恢复被暂停的调度。
+func (sched *schedulerImpl) Resume() error {
+	if sched.stopSign.IsSigned() {
+		return errors.New("The scheduler has been stoped.")
+	}
+	if !atomic.CompareAndSwapUint32(&sched.status, SCHEDULER_STATUS_PAUSED, SCHEDULER_STATUS_RUNNING) {
+		return errors.New("The scheduler is not paused.")
+	}
+	return nil
+}
+
+// 判断调度器是否已暂停。
+func (sched *schedulerImpl) paused() bool {
+	return atomic.LoadUint32(&sched.status) == SCHEDULER_STATUS_PAUSED
+}
+
 func (sched *schedulerImpl) Summary() SchedSummary{
 	return NewSchedSummary(sched, " ")
 }
 
 // 开始下载。
 func (sched *schedulerImpl) startDownloading() {
+	reqChan := sched.getReqChan()
 	go func() {
 		for {
-			req, ok := <-sched.getReqChan()
+			req, ok := <-reqChan
 			if !ok {
 				logs.Error("Get request channel Error. \n")
 				break
 			}
 			logs.Debug("scheduler requestchan ")
+			atomic.AddInt64(&sched.downloading, 1)
 			go sched.download(req)
 		}
 	}()
@@ -223,9 +435,10 @@ func (sched *schedulerImpl) startDownloading() {
 
 
 func (sched *schedulerImpl) startPageParsing() {
+	respChan := sched.getRespChan()
 	go func() {
 		for {
-			resp, ok := <-sched.getRespChan()
+			resp, ok := <-respChan
 			if !ok {
 				logs.Error("Get response channel Error.\n")
 				break
@@ -236,12 +449,14 @@ func (sched *schedulerImpl) startPageParsing() {
 }
 
 func (sched *schedulerImpl) startItemPipeLine() {
+	itemChan := sched.getItemChan()
 	go func() {
 		sched.itemPipeline.SetFastFail(true)
 		code := ITEMPIPELINE_CODE
-		for item := range sched.getItemChan() {
+		for item := range itemChan {
 			go func(item basic.ItemMap) {
-				errs := sched.itemPipeline.Send(item)
+				defer atomic.AddInt64(&sched.processing, -1)
+				errs := sched.itemPipeline.Send(sched.ctx, item)
 				if errs != nil {
 					for _, err := range errs {
 						sched.sendError(err, code)
@@ -259,25 +474,36 @@ func (sched *schedulerImpl) startItemPipeLine() {
 }
 
 func (sched *schedulerImpl) startSchedule(interval time.Duration) {
+	reqChan := sched.getReqChan()
 	go func() {
 		for {
 			if sched.stopSign.IsSigned() {
 				sched.stopSign.Record(SCHEDULER_CODE)
 				return
 			}
-			if sched.channelManager.Status() == util.CHANNEL_MANAGER_STATUS_INITIALIZED{
-				remainder := cap(sched.getReqChan()) - len(sched.getReqChan())
+			if sched.channelManager.Status() == util.CHANNEL_MANAGER_STATUS_INITIALIZED &&
+				!sched.paused() && !sched.isDraining() {
+				// 从请求缓存预取请求，再按主机轮询发送。
+				sched.throttle.Prefetch(sched.reqCache, time.Now())
+				remainder := cap(reqChan) - len(reqChan)
 				for ; remainder > 0; remainder-- {
 
 					if sched.stopSign.IsSigned() {
 						sched.stopSign.Record(SCHEDULER_CODE)
 						return
 					}
-					newReq := sched.reqCache.Get()
+					newReq := sched.throttle.Next(time.Now())
 					if newReq==nil {
-						continue
+						break
 					}
-					sched.getReqChan() <- newReq
+					sched.guardSend(func(stopped <-chan struct{}) bool {
+						select {
+						case reqChan <- newReq:
+							return true
+						case <-stopped:
+							return false
+						}
+					})
 				}
 			}
 			time.Sleep(interval)
@@ -286,6 +512,9 @@ func (sched *schedulerImpl) startSchedule(interval time.Duration) {
 }
 
 func (sched *schedulerImpl) addRequestDomain(req *http.Request) error {
+	if !downloader.IsHTTPScheme(req.URL.Scheme) {
+		return nil
+	}
 	err := sched.AddPermitDomain(req.Host)
 	if err != nil {
 		return err
@@ -294,6 +523,8 @@ func (sched *schedulerImpl) addRequestDomain(req *http.Request) error {
 }
 
 func (sched *schedulerImpl) parsePage(parsers []pageParser.ParseResponse, resp *basic.DownloadRespond) {
+	defer atomic.AddInt64(&sched.parsing, -1)
+	defer sched.parsed(resp)
 	defer func() {
 		if p := recover(); p != nil {
 			logs.Error("Fatal parsing Error: %s\n")
@@ -317,12 +548,16 @@ func (sched *schedulerImpl) parsePage(parsers []pageParser.ParseResponse, resp *
 
 	code := generateCode(PARSER_CODE, pageParser.Id())
 
-	results, errs := pageParser.ParsePage(parsers, resp)
+	results, errs := pageParser.ParsePage(sched.ctx, parsers, resp)
 	if errs != nil {
 		for _, err := range errs {
 			sched.sendError(err, code)
 		}
 	}
+	var parent *url.URL
+	if httpResp := resp.HttpResp(); httpResp != nil && httpResp.Request != nil {
+		parent = httpResp.Request.URL
+	}
 	if results != nil {
 		for _, result := range results {
 			if result == nil {
@@ -330,7 +565,7 @@ func (sched *schedulerImpl) parsePage(parsers []pageParser.ParseResponse, resp *
 			}
 			switch t := result.(type) {
 			case *basic.DownloadRequest:
-				sched.sendReqToCache(t, code)
+				sched.sendReqToCache(t, parent, code)
 			case basic.ItemMap:
 				sched.sendItemMap(t, code)
 			default:
@@ -341,7 +576,30 @@ func (sched *schedulerImpl) parsePage(parsers []pageParser.ParseResponse, resp *
 	}
 }
 
+// 响应分析完毕，得到的新请求已放入请求缓存，告知请求缓存对应的请求已完成。
+func (sched *schedulerImpl) parsed(resp *basic.DownloadRespond) {
+	if req, ok := sched.awaitingParse.Load(resp); ok {
+		sched.awaitingParse.Delete(resp)
+		sched.reqCache.Done(req.(*basic.DownloadRequest))
+	}
+}
+
 func (sched *schedulerImpl) download(req *basic.DownloadRequest) {
+	defer atomic.AddInt64(&sched.downloading, -1)
+	defer sched.throttle.Done(req)
+	// 优雅关闭期间不再开始新的下载，请求保留在持久化的爬取边界中。
+	if sched.isDraining() {
+		atomic.AddUint64(&sched.skipped, 1)
+		return
+	}
+	// 响应交给分析器后，由分析完毕时告知请求缓存该请求已完成，
+	// 以免在分析得到的新请求持久化之前崩溃而丢失这些请求。
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			sched.reqCache.Done(req)
+		}
+	}()
 
 	defer func() {
 		if p := recover(); p != nil {
@@ -349,6 +607,12 @@ func (sched *schedulerImpl) download(req *basic.DownloadRequest) {
 		}
 	}()
 
+	// 取消上下文同时中止robots.txt的获取与下载。
+	req.SetContext(sched.ctx)
+	if !sched.allowedByRobots(req) {
+		return
+	}
+
 
 	dl, err := sched.dlPool.Take()
 	if err != nil {
@@ -367,15 +631,114 @@ func (sched *schedulerImpl) download(req *basic.DownloadRequest) {
 	code := generateCode(DOWNLOADER_CODE, dl.Id())
 
 	respond, err := dl.Download(req)
+	if handled, keep := sched.intercepted(req, err); handled {
+		// 重新调度的请求未能放入请求缓存时，原请求留在请求缓存中不告知已完成。
+		handedOff = keep
+		return
+	}
+	if sched.retry(req, respond, err) {
+		return
+	}
 
 	if err != nil {
 		logs.Error("Downloader Error: %s\n", err)
+		if req.Attempt() > 0 {
+			err = fmt.Errorf("%s (attempts=%d)", err, req.Attempt()+1)
+		}
 		sched.sendError(err, code)
 	}
 
 	if respond != nil {
-		sched.sendResp(respond, code)
+		if sched.queueRedirect(req, respond, code) {
+			return
+		}
+		if timing := respond.Timing(); timing.Total > 0 && downloader.IsHTTPScheme(req.HttpReq().URL.Scheme) {
+			sched.timings.Record(req.HttpReq().URL.Host, timing)
+		}
+		sched.awaitingParse.Store(respond, req)
+		if handedOff = sched.sendResp(respond, code); !handedOff {
+			sched.awaitingParse.Delete(respond)
+		}
+	}
+}
+
+// 处理中间件丢弃或要求重新调度请求的情况，这两种情况都不视为下载失败。
+// 重新调度的请求未能放入请求缓存时keep为true，原请求不应告知请求缓存已完成，以免丢失。
+func (sched *schedulerImpl) intercepted(req *basic.DownloadRequest, err error) (handled bool, keep bool) {
+	if err == nil {
+		return false, false
+	}
+	if errors.Is(err, downloader.ErrDropRequest) {
+		logs.Info("The request is dropped by middleware. (requestUrl=%s)\n", req.HttpReq().URL)
+		return true, false
+	}
+	var reschedule *downloader.RescheduleError
+	if !errors.As(err, &reschedule) {
+		return false, false
+	}
+	if sched.stopSign.IsSigned() {
+		return true, false
+	}
+	next := reschedule.Request
+	if next == nil {
+		next = req
+	}
+	next = next.NextAttempt(time.Now().Add(reschedule.Delay))
+	if err := sched.reqCache.Put(next); err != nil {
+		sched.sendError(fmt.Errorf("Put the rescheduled request into the request cache error: %s (requestUrl=%s)",
+			err, next.HttpReq().URL), FRONTIER_CODE)
+		return true, true
+	}
+	logs.Info("Reschedule the request after %s. (requestUrl=%s)\n", reschedule.Delay, next.HttpReq().URL)
+	return true, false
+}
+
+// 按重试策略判断下载是否需要重试，需要时丢弃响应并将请求直接放回请求缓存。
+// 调度器的上下文已被取消或超时的，下载的失败源于爬取本身的结束，不再重试。
+func (sched *schedulerImpl) retry(req *basic.DownloadRequest, respond *basic.DownloadRespond, err error) bool {
+	if sched.retryPolicy == nil || sched.stopSign.IsSigned() || sched.ctx.Err() != nil {
+		return false
+	}
+	delay, ok := sched.retryPolicy.Retry(req, respond, err)
+	if !ok {
+		return false
+	}
+	next := req.NextAttempt(time.Now().Add(delay))
+	// 未能放回请求缓存时不重试，按本次下载的结果处理。
+	if err := sched.reqCache.Put(next); err != nil {
+		sched.sendError(fmt.Errorf("Put the retry request into the request cache error: %s (requestUrl=%s)",
+			err, req.HttpReq().URL), FRONTIER_CODE)
+		return false
+	}
+	if respond != nil && respond.HttpResp() != nil && respond.HttpResp().Body != nil {
+		respond.HttpResp().Body.Close()
 	}
+	logs.Info("Retry the request after %s, attempt %d. (requestUrl=%s)\n",
+		delay, next.Attempt()+1, req.HttpReq().URL)
+	return true
+}
+
+// 在限流器首次向主机发送请求之前获取其robots.txt，并将声明的爬取间隔告知限流器。
+func (sched *schedulerImpl) resolveRobots(req *basic.DownloadRequest) {
+	sched.throttle.Resolved(req, sched.robots.CrawlDelay(sched.ctx, req.HttpReq().URL))
+}
+
+// 检查robots.txt是否允许请求，并将主机声明的爬取间隔告知限流器。
+// 被拒绝的请求会发送到错误通道。
+func (sched *schedulerImpl) allowedByRobots(req *basic.DownloadRequest) bool {
+	if sched.robots == nil {
+		return true
+	}
+	ctx := req.HttpReq().Context()
+	reqUrl := req.HttpReq().URL
+	allowed, reason := sched.robots.Allowed(ctx, reqUrl)
+	if !allowed {
+		errMsg := fmt.Sprintf("The request is rejected by robots.txt: %s. (requestUrl=%s)", reason, reqUrl)
+		sched.sendError(errors.New(errMsg), ROBOTS_CODE)
+		return false
+	}
+	sched.throttle.SetCrawlDelay(req, sched.robots.CrawlDelay(ctx, reqUrl))
+	return true
 }
 
 func (sched *schedulerImpl) sendError(err error, code string) bool {
@@ -392,15 +755,28 @@ func (sched *schedulerImpl) sendError(err error, code string) bool {
 		errorType = basic.PAGEPARSER_ERROR
 	case ITEMPIPELINE_CODE:
 		errorType = basic.ITEM_PROCESSOR_ERROR
+	case FRONTIER_CODE:
+		errorType = basic.FRONTIER_ERROR
+	case ROBOTS_CODE:
+		errorType = basic.ROBOTS_ERROR
+	}
+	// 已带有类型的爬虫错误（如响应过大、内容类型不被允许）保持原有类型。
+	detailErr, ok := err.(basic.CrawlerError)
+	if !ok {
+		detailErr = basic.NewCrawlerError(errorType, err.Error())
 	}
-	detailErr := basic.NewCrawlerError(errorType, err.Error())
 	if sched.stopSign.IsSigned() {
 		sched.stopSign.Record(code)
 		return false
 	}
-	go func() {
-		sched.getErrorChan() <- detailErr
-	}()
+	go sched.guardSend(func(stopped <-chan struct{}) bool {
+		select {
+		case sched.getErrorChan() <- detailErr:
+			return true
+		case <-stopped:
+			return false
+		}
+	})
 	return true
 }
 
@@ -418,8 +794,19 @@ func (sched *schedulerImpl) sendResp(respond *basic.DownloadRespond, code string
 		logs.Warning("Receive nil response.")
 		return false
 	}
-	sched.getRespChan() <- respond
-	return true
+	atomic.AddInt64(&sched.parsing, 1)
+	sent := sched.guardSend(func(stopped <-chan struct{}) bool {
+		select {
+		case sched.getRespChan() <- respond:
+			return true
+		case <-stopped:
+			return false
+		}
+	})
+	if !sent {
+		atomic.AddInt64(&sched.parsing, -1)
+	}
+	return sent
 
 }
 
@@ -432,61 +819,142 @@ func (sched *schedulerImpl) sendItemMap(itemMap basic.ItemMap, code string) bool
 		logs.Warning("Receive nil Item map.")
 		return false
 	}
-	sched.getItemChan() <- itemMap
+	atomic.AddInt64(&sched.processing, 1)
+	sent := sched.guardSend(func(stopped <-chan struct{}) bool {
+		select {
+		case sched.getItemChan() <- itemMap:
+			return true
+		case <-stopped:
+			return false
+		}
+	})
+	if !sent {
+		atomic.AddInt64(&sched.processing, -1)
+	}
+	return sent
+
+}
+
+func (sched *schedulerImpl) sendReqToCache(req *basic.DownloadRequest, parent *url.URL, code string) bool {
+	if sched.stopSign.IsSigned() {
+		sched.stopSign.Record(code)
+		return false
+	}
+	if err := sched.enqueue(req, parent); err != nil {
+		if _, ok := err.(putError); ok {
+			sched.sendError(err, FRONTIER_CODE)
+		} else {
+			logs.Debug("%s\n", err)
+		}
+		return false
+	}
 	return true
+}
 
+// 在运行时向调度器加入请求，与分析得到的请求经过相同的域名、深度与去重检查。
+func (sched *schedulerImpl) Enqueue(req *basic.DownloadRequest) error {
+	if sched.stopSign.IsSigned() {
+		return errors.New("The scheduler has been stoped.")
+	}
+	if sched.isDraining() {
+		return errors.New("The scheduler is shutting down.")
+	}
+	return sched.enqueue(req, nil)
 }
 
-func (sched *schedulerImpl) sendReqToCache(req *basic.DownloadRequest, code string) bool {
+// 请求未能放入请求缓存的错误，以区别于请求被忽略的原因。
+type putError struct {
+	error
+}
+
+// 检查请求并放入请求缓存，被忽略时返回原因，放入失败时返回putError。parent为得到该请求的页面的URL，
+// 来自http与https页面的非http协议的请求总是被忽略，避免远程页面引导爬虫读取本地文件等资源。
+func (sched *schedulerImpl) enqueue(req *basic.DownloadRequest, parent *url.URL) error {
 	if req == nil || req.HttpReq() == nil {
-		logs.Warning("Receive nil request.")
-		return false
+		return errors.New("Ignore the request! It's nil.")
 	}
 	reqUrl := req.HttpReq().URL
 
 	if reqUrl == nil {
-		logs.Warning("Ignore the request! It's url is is invalid!")
-		return false
+		return errors.New("Ignore the request! It's url is is invalid!")
 	}
-	if strings.ToLower(reqUrl.Scheme) != "http" {
-		if reqUrl.Scheme == "javascript" {
-			logs.Debug("Ignore request scheme '%s'.", reqUrl.Scheme)
-			return false
-		}
-		logs.Debug("Find request %s, scheme '%s'.",reqUrl.String(), reqUrl.Scheme)
-		//return false
+	if !sched.schemes.Supported(reqUrl.Scheme) {
+		return fmt.Errorf("Ignore the request! It's scheme '%s' is not supported. (requestUrl=%s)",
+			reqUrl.Scheme, reqUrl)
 	}
-	sched.mapLock.RLock()
-	if _, ok := sched.urlMap[reqUrl.String()]; ok {
-		logs.Debug("Ignore the request! It's url is repeated. (requestUrl=%s)\n", reqUrl)
-		sched.mapLock.RUnlock()
-		return false
+	if parent != nil && downloader.IsHTTPScheme(parent.Scheme) && !downloader.IsHTTPScheme(reqUrl.Scheme) {
+		return fmt.Errorf("Ignore the request! It's scheme '%s' is not allowed from page %s. (requestUrl=%s)",
+			reqUrl.Scheme, parent, reqUrl)
+	}
+	if sched.dupeFilter.Contains(sched.fingerprint(req)) {
+		return fmt.Errorf("Ignore the request! It's url is repeated. (requestUrl=%s)", reqUrl)
 	}
-	sched.mapLock.RUnlock()
 
+	// 许可域名只限制http与https的请求，file、data等协议的URL没有可比较的主机，
+	// 它们只能来自种子、Enqueue或同样是非http协议的页面。
 	domain, _ := util.GetPrimaryDomain(req.HttpReq().Host)
-	if _, ok := sched.acceptDomain[domain]; !ok {
-		logs.Debug("Ignore the request! It's host '%s' not in primary domain . (requestUrl=%s)\n",
+	if downloader.IsHTTPScheme(reqUrl.Scheme) && !sched.permitted(domain) {
+		return fmt.Errorf("Ignore the request! It's host '%s' not in primary domain . (requestUrl=%s)",
 			req.HttpReq().Host, reqUrl)
-		return false
 	}
 	if req.Depth() > sched.crawMaxDepth {
-		logs.Debug("Ignore the request! It's depth %d greater than %d. (requestUrl=%s)\n",
+		return fmt.Errorf("Ignore the request! It's depth %d greater than %d. (requestUrl=%s)",
 			req.Depth(), sched.crawMaxDepth, reqUrl)
-		return false
 	}
 
-	if sched.stopSign.IsSigned() {
-		sched.stopSign.Record(code)
-		return false
+	put, err := sched.putUnseen(req)
+	if err != nil {
+		return putError{fmt.Errorf("Put the request into the request cache error: %s (requestUrl=%s)", err, reqUrl)}
 	}
-	sched.reqCache.Put(req)
+	if !put {
+		return fmt.Errorf("Ignore the request! It's url is repeated. (requestUrl=%s)", reqUrl)
+	}
+	return nil
+}
 
-	sched.mapLock.Lock()
-	sched.urlMap[reqUrl.String()] = true
-	sched.mapLock.Unlock()
+// 判断主域名是否许可。
+func (sched *schedulerImpl) permitted(domain string) bool {
+	sched.RLock()
+	defer sched.RUnlock()
+	_, ok := sched.acceptDomain[domain]
+	return ok
+}
 
-	return true
+// 获得请求用于去重的指纹：GET请求为规范化后的URL，其他请求还包括请求方法与请求体。
+func (sched *schedulerImpl) fingerprint(req *basic.DownloadRequest) string {
+	if spec := req.Spec(); spec != nil {
+		return spec.Fingerprint(sched.canonicalizer.Canonicalize)
+	}
+	return sched.canonicalizer.Canonicalize(req.HttpReq().URL)
+}
+
+// 将未见过的请求放入请求缓存并将其指纹记录为已见，如果此前未见过且放入成功则返回true。
+// 放入成功后才记录，以免请求未能持久化而其URL已被记录为已见，恢复爬取时该请求丢失。
+func (sched *schedulerImpl) putUnseen(req *basic.DownloadRequest) (bool, error) {
+	key := sched.fingerprint(req)
+	sched.seenLock.Lock()
+	defer sched.seenLock.Unlock()
+	if sched.dupeFilter.Contains(key) {
+		return false, nil
+	}
+	if err := sched.reqCache.Put(req); err != nil {
+		return false, err
+	}
+	sched.dupeFilter.TestAndAdd(key)
+	return true, nil
+}
+
+// 在持有发送锁的情况下发送，调度器停止后不再发送，避免向已关闭的通道发送。
+// send应在stopped被关闭时放弃阻塞的发送。
+func (sched *schedulerImpl) guardSend(send func(stopped <-chan struct{}) bool) bool {
+	sched.sendLock.RLock()
+	defer sched.sendLock.RUnlock()
+	select {
+	case <-sched.stopped:
+		return false
+	default:
+	}
+	return send(sched.stopped)
 }
 
 func generateCode(prefix string, id uint32) string {
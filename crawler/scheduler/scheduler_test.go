@@ -0,0 +1,941 @@
+package scheduler
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"chaoshen.com/crawlergo/crawler/downloader"
+	"chaoshen.com/crawlergo/crawler/pageParser"
+	"chaoshen.com/crawlergo/crawler/pipeline"
+	"chaoshen.com/crawlergo/crawler/proxy"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testHrefRegexp = regexp.MustCompile(`href="([^"]+)"`)
+
+// 以href属性得到新请求的分析函数，同时为每个页面产生一个带url的条目。
+func testLinkParser(ctx context.Context, respond *basic.DownloadRespond) ([]basic.BaseData, []error) {
+	httpResp := respond.HttpResp()
+	dataList := make([]basic.BaseData, 0)
+	errorList := make([]error, 0)
+	for _, match := range testHrefRegexp.FindAllStringSubmatch(respond.Text(), -1) {
+		u, err := httpResp.Request.URL.Parse(match[1])
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
+		}
+		httpReq, err := http.NewRequest("GET", u.String(), nil)
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
+		}
+		dataList = append(dataList, basic.NewDownloadRequest(0, httpReq, respond.Depth()+1))
+	}
+	dataList = append(dataList, basic.ItemMap{"url": httpResp.Request.URL.String()})
+	return dataList, errorList
+}
+
+// 记录处理过的条目的条目处理器。
+type testItems struct {
+	lock  sync.Mutex
+	urls  []string
+	delay time.Duration // 处理每个条目前的等待时间。
+}
+
+func (items *testItems) process(ctx context.Context, item basic.ItemMap) (basic.ItemMap, error) {
+	time.Sleep(items.delay)
+	items.lock.Lock()
+	defer items.lock.Unlock()
+	if u, ok := item["url"].(string); ok {
+		items.urls = append(items.urls, u)
+	}
+	return item, nil
+}
+
+func (items *testItems) count() int {
+	items.lock.Lock()
+	defer items.lock.Unlock()
+	return len(items.urls)
+}
+
+// 记录每个路径被请求次数的测试服务器。
+type testServer struct {
+	*httptest.Server
+	lock sync.Mutex
+	hits map[string]int
+}
+
+func newTestServer(handler http.HandlerFunc) *testServer {
+	server := &testServer{hits: map[string]int{}}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.lock.Lock()
+		server.hits[r.URL.RequestURI()]++
+		server.lock.Unlock()
+		handler(w, r)
+	}))
+	return server
+}
+
+func (server *testServer) hit(uri string) int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.hits[uri]
+}
+
+// 记录错误通道中的错误。
+type testErrors struct {
+	lock sync.Mutex
+	errs []error
+}
+
+func (errs *testErrors) ofType(errType basic.ErrorType) []error {
+	errs.lock.Lock()
+	defer errs.lock.Unlock()
+	found := make([]error, 0)
+	for _, err := range errs.errs {
+		if crawlerErr, ok := err.(basic.CrawlerError); ok && crawlerErr.Type() == errType {
+			found = append(found, err)
+		}
+	}
+	return found
+}
+
+func newTestScheduler(t *testing.T, items *testItems, opts ...SchedOption) (*schedulerImpl, *testErrors) {
+	return newTestSchedulerWithParser(t, testLinkParser, items, opts...)
+}
+
+func newTestSchedulerWithParser(t *testing.T, parser pageParser.ParseResponse, items *testItems,
+	opts ...SchedOption) (*schedulerImpl, *testErrors) {
+	sched, err := NewScheduler(3,
+		basic.NewChannelConfig(10, 10, 10, 100),
+		basic.NewPoolBaseConfig(3, 3),
+		func() *http.Client { return &http.Client{} },
+		[]pageParser.ParseResponse{parser},
+		[]itemproc.ProcessItem{items.process},
+		opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	impl := sched.(*schedulerImpl)
+	// 持续接收错误通道中的错误，避免发送方阻塞。
+	errs := &testErrors{}
+	errorChan := impl.getErrorChan()
+	go func() {
+		for err := range errorChan {
+			errs.lock.Lock()
+			errs.errs = append(errs.errs, err)
+			errs.lock.Unlock()
+		}
+	}()
+	return impl, errs
+}
+
+func newTestRequest(t *testing.T, url string) *http.Request {
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httpReq
+}
+
+// 等待条件成立，超时则测试失败。
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s.", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// 等待调度器没有任何待处理与在途的工作。
+func waitIdle(t *testing.T, sched *schedulerImpl) {
+	stable := 0
+	waitFor(t, 5*time.Second, "the scheduler to be idle", func() bool {
+		if sched.Idle() && sched.drained() {
+			stable++
+		} else {
+			stable = 0
+		}
+		return stable >= 5
+	})
+}
+
+// 记录Put与Done顺序的请求缓存。
+type recordingCache struct {
+	basic.RequestCache
+	lock   sync.Mutex
+	events []string
+}
+
+func (cache *recordingCache) record(op string, req *basic.DownloadRequest) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.events = append(cache.events, op+" "+req.HttpReq().URL.Path)
+}
+
+// 在放入请求缓存前记录，放入后请求可能已被取出下载。
+func (cache *recordingCache) Put(req *basic.DownloadRequest) error {
+	cache.record("put", req)
+	return cache.RequestCache.Put(req)
+}
+
+func (cache *recordingCache) Done(req *basic.DownloadRequest) {
+	cache.record("done", req)
+	cache.RequestCache.Done(req)
+}
+
+func (cache *recordingCache) index(event string) int {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	for i, e := range cache.events {
+		if e == event {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestSchedulerDoneAfterParse(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/child"></a>`))
+		}
+	})
+	defer server.Close()
+	// 分析较慢，下载完成后仍需一段时间才能得到新请求。
+	slowParser := func(ctx context.Context, respond *basic.DownloadRespond) ([]basic.BaseData, []error) {
+		time.Sleep(50 * time.Millisecond)
+		return testLinkParser(ctx, respond)
+	}
+	items := &testItems{}
+	sched, _ := newTestSchedulerWithParser(t, slowParser, items)
+	cache := &recordingCache{RequestCache: sched.reqCache}
+	sched.reqCache = cache
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitIdle(t, sched)
+	put, done := cache.index("put /child"), cache.index("done /")
+	if put < 0 || done < 0 || done < put {
+		t.Fatalf("The request should be done after its children are queued: %v", cache.events)
+	}
+	if cache.index("done /child") < 0 {
+		t.Fatalf("The child request should be done: %v", cache.events)
+	}
+}
+
+// 指定路径的请求放入失败的请求缓存。
+type failingCache struct {
+	basic.RequestCache
+	lock sync.Mutex
+	fail map[string]bool
+}
+
+func (cache *failingCache) setFail(path string, fail bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.fail[path] = fail
+}
+
+func (cache *failingCache) Put(req *basic.DownloadRequest) error {
+	cache.lock.Lock()
+	fail := cache.fail[req.HttpReq().URL.Path]
+	cache.lock.Unlock()
+	if fail {
+		return errors.New("The request cache is broken.")
+	}
+	return cache.RequestCache.Put(req)
+}
+
+func TestSchedulerPutErrorNotSeen(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/child"></a>`))
+		}
+	})
+	defer server.Close()
+	items := &testItems{}
+	sched, errs := newTestScheduler(t, items)
+	cache := &failingCache{RequestCache: sched.reqCache, fail: map[string]bool{"/": true, "/child": true}}
+	sched.reqCache = cache
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err == nil {
+		t.Fatal("The start should fail when the first request cannot be put.")
+	}
+	cache.setFail("/", false)
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitIdle(t, sched)
+	waitFor(t, time.Second, "the frontier error", func() bool {
+		return len(errs.ofType(basic.FRONTIER_ERROR)) == 1
+	})
+	if server.hit("/child") != 0 {
+		t.Fatal("The request failed to be put should not be downloaded.")
+	}
+	if err := sched.Enqueue(basic.NewDownloadRequest(0, newTestRequest(t, server.URL+"/child"), 1)); err == nil {
+		t.Fatal("The enqueue should fail when the request cannot be put.")
+	}
+	// 放入失败的请求没有被记录为已见，之后仍可放入。
+	cache.setFail("/child", false)
+	if err := sched.Enqueue(basic.NewDownloadRequest(0, newTestRequest(t, server.URL+"/child"), 1)); err != nil {
+		t.Fatalf("The request failed to be put should not be marked seen: %s", err)
+	}
+	waitIdle(t, sched)
+	if server.hit("/child") != 1 {
+		t.Fatalf("The child request should be downloaded once, got %d", server.hit("/child"))
+	}
+}
+
+func TestSchedulerPauseResume(t *testing.T) {
+	started := make(chan struct{}, 1)
+	gate := make(chan struct{})
+	// 链式页面，/1被阻塞直到放行。
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<a href="/1"></a>`))
+		case "/1":
+			started <- struct{}{}
+			<-gate
+			w.Write([]byte(`<a href="/2"></a>`))
+		}
+	})
+	defer server.Close()
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items)
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	if err := sched.Resume(); err == nil {
+		t.Fatal("The running scheduler should not be resumed.")
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the request to start.")
+	}
+	if err := sched.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sched.Pause(); err == nil {
+		t.Fatal("The paused scheduler should not be paused again.")
+	}
+	// 暂停前已开始的下载照常完成并分析。
+	close(gate)
+	waitFor(t, 5*time.Second, "the in-flight page to be processed", func() bool {
+		return items.count() == 2
+	})
+	time.Sleep(100 * time.Millisecond)
+	if sched.Status() != SCHEDULER_STATUS_PAUSED || sched.Idle() {
+		t.Fatalf("The paused scheduler with pending requests should not be idle, status %d", sched.Status())
+	}
+	if server.hit("/2") != 0 {
+		t.Fatal("The paused scheduler should not send new requests.")
+	}
+
+	if err := sched.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	waitIdle(t, sched)
+	if server.hit("/2") != 1 || items.count() != 3 {
+		t.Fatalf("The pending request should be crawled after resuming, got %d hits and %d items",
+			server.hit("/2"), items.count())
+	}
+}
+
+func TestMonitoringPausedScheduler(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items)
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitIdle(t, sched)
+	if err := sched.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	// 暂停的调度器即使没有待处理的工作也不能视为爬取完毕。
+	done := Monitoring(sched, 5*time.Millisecond, false)
+	select {
+	case <-done:
+		t.Fatal("The monitor should not stop a paused scheduler.")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if sched.Status() != SCHEDULER_STATUS_PAUSED {
+		t.Fatalf("The scheduler should stay paused, status %d", sched.Status())
+	}
+	if err := sched.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The monitor should stop the resumed scheduler when it is idle.")
+	}
+	if sched.Status() != SCHEDULER_STATUS_CLOSED {
+		t.Fatalf("The scheduler should be closed, status %d", sched.Status())
+	}
+}
+
+func TestSchedulerStopWhilePaused(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items)
+	if err := sched.Pause(); err == nil {
+		t.Fatal("The scheduler not started should not be paused.")
+	}
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sched.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sched.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if sched.Status() != SCHEDULER_STATUS_CLOSED {
+		t.Fatalf("The scheduler should be closed, status %d", sched.Status())
+	}
+	if err := sched.Resume(); err == nil {
+		t.Fatal("The stopped scheduler should not be resumed.")
+	}
+	if err := sched.Pause(); err == nil {
+		t.Fatal("The stopped scheduler should not be paused.")
+	}
+}
+
+func TestSchedulerContextCancel(t *testing.T) {
+	started := make(chan struct{}, 1)
+	aborted := make(chan struct{}, 1)
+	release := make(chan struct{})
+	// 请求被客户端中止前一直阻塞。
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			aborted <- struct{}{}
+		case <-release:
+		}
+	})
+	defer server.Close()
+	defer close(release)
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := sched.Start(ctx, newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the request to start.")
+	}
+	cancel()
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The in-flight request should be aborted by cancelling the context.")
+	}
+	waitFor(t, 5*time.Second, "the scheduler to stop", func() bool {
+		return sched.Status() == SCHEDULER_STATUS_CLOSED
+	})
+	if err := sched.Enqueue(basic.NewDownloadRequest(0, newTestRequest(t, server.URL+"/next"), 1)); err == nil {
+		t.Fatal("The stopped scheduler should reject new requests.")
+	}
+	if items.count() != 0 {
+		t.Fatalf("The aborted response should not be parsed, got %d items", items.count())
+	}
+}
+
+func TestSchedulerContextCancelRobots(t *testing.T) {
+	started := make(chan struct{}, 1)
+	aborted := make(chan struct{}, 1)
+	release := make(chan struct{})
+	// robots.txt被客户端中止前一直阻塞。
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			return
+		}
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			aborted <- struct{}{}
+		case <-release:
+		}
+	})
+	defer server.Close()
+	defer close(release)
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items, WithRobots("testbot", 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := sched.Start(ctx, newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the robots.txt request to start.")
+	}
+	cancel()
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The robots.txt request should be aborted by cancelling the context.")
+	}
+	if server.hit("/") != 0 {
+		t.Fatal("The page should not be downloaded after cancelling.")
+	}
+}
+
+func TestSchedulerEnqueue(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+	other := newTestServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer other.Close()
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items)
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitIdle(t, sched)
+
+	if err := sched.Enqueue(basic.NewDownloadRequest(0, newTestRequest(t, server.URL+"/extra"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitIdle(t, sched)
+	if server.hit("/extra") != 1 {
+		t.Fatalf("The enqueued request should be crawled once, got %d", server.hit("/extra"))
+	}
+	rejected := []struct {
+		what string
+		url  string
+		dep  uint32
+	}{
+		{"duplicate seed", server.URL + "/", 1},
+		{"duplicate request", server.URL + "/extra", 1},
+		{"out-of-domain request", other.URL + "/", 1},
+		{"too deep request", server.URL + "/deep", 4},
+	}
+	for _, r := range rejected {
+		if err := sched.Enqueue(basic.NewDownloadRequest(0, newTestRequest(t, r.url), r.dep)); err == nil {
+			t.Errorf("The %s should be rejected.", r.what)
+		}
+	}
+	// 加入许可域名后可以爬取其他域名。
+	if err := sched.AddPermitDomain(other.Listener.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := sched.Enqueue(basic.NewDownloadRequest(0, newTestRequest(t, other.URL+"/"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitIdle(t, sched)
+	if server.hit("/") != 1 || server.hit("/deep") != 0 || other.hit("/") != 1 {
+		t.Fatalf("Unexpected hits: / %d, /deep %d, other / %d", server.hit("/"), server.hit("/deep"), other.hit("/"))
+	}
+	if items.count() != 3 {
+		t.Fatalf("Expected 3 items, got %d", items.count())
+	}
+}
+
+func TestSchedulerMultipleSeeds(t *testing.T) {
+	other := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/page"></a>`))
+		}
+	})
+	defer other.Close()
+	// 第一个站点同时链接到第二个站点已有的页面。
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<a href="/page"></a><a href="%s/page"></a>`, other.URL)
+		}
+	})
+	defer server.Close()
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items)
+	seeds := []*http.Request{
+		newTestRequest(t, server.URL+"/"),
+		newTestRequest(t, other.URL+"/"),
+		newTestRequest(t, server.URL+"/"),
+	}
+	if err := sched.Start(context.Background(), seeds...); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitIdle(t, sched)
+	for _, s := range []*testServer{server, other} {
+		for _, path := range []string{"/", "/page"} {
+			if hits := s.hit(path); hits != 1 {
+				t.Errorf("The page %s%s should be crawled once, got %d", s.URL, path, hits)
+			}
+		}
+	}
+	if items.count() != 4 {
+		t.Fatalf("Expected 4 items, got %d", items.count())
+	}
+}
+
+func TestSchedulerShutdownDrains(t *testing.T) {
+	// 下载、分析与条目处理都较慢，关闭时三者都有在途的工作。
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`<a href="/next"></a>`))
+	})
+	defer server.Close()
+	slowParser := func(ctx context.Context, respond *basic.DownloadRespond) ([]basic.BaseData, []error) {
+		time.Sleep(50 * time.Millisecond)
+		return testLinkParser(ctx, respond)
+	}
+	items := &testItems{delay: 50 * time.Millisecond}
+	sched, _ := newTestSchedulerWithParser(t, slowParser, items)
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitFor(t, 5*time.Second, "the download to start", func() bool {
+		return server.hit("/") == 1
+	})
+	type result struct {
+		report ShutdownReport
+		err    error
+	}
+	results := make(chan result, 1)
+	go func() {
+		report, err := sched.Shutdown(5 * time.Second)
+		results <- result{report, err}
+	}()
+	waitFor(t, time.Second, "the scheduler to drain", sched.isDraining)
+	if err := sched.Enqueue(basic.NewDownloadRequest(0, newTestRequest(t, server.URL+"/extra"), 1)); err == nil {
+		t.Fatal("The draining scheduler should reject new requests.")
+	}
+	if _, err := sched.Shutdown(time.Second); err == nil {
+		t.Fatal("The draining scheduler should not be shut down again.")
+	}
+	var res result
+	select {
+	case res = <-results:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the shutdown.")
+	}
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	// 在途的下载、分析与条目处理都已完成，分析得到的新请求留在请求缓存中。
+	report := res.report
+	if report.TimedOut || report.Downloads != 0 || report.Responses != 0 || report.Items != 0 {
+		t.Fatalf("Unexpected report: %s", report)
+	}
+	if report.PendingRequests != 1 || server.hit("/next") != 0 {
+		t.Fatalf("The parsed request should be pending, got %s and %d hits", report, server.hit("/next"))
+	}
+	if items.count() != 1 {
+		t.Fatalf("The in-flight item should be processed, got %d items", items.count())
+	}
+	if sched.Status() != SCHEDULER_STATUS_CLOSED {
+		t.Fatalf("The scheduler should be closed, status %d", sched.Status())
+	}
+}
+
+func TestSchedulerShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	})
+	defer server.Close()
+	defer close(release)
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items)
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitFor(t, 5*time.Second, "the download to start", func() bool {
+		return server.hit("/") == 1
+	})
+	start := time.Now()
+	report, err := sched.Shutdown(100 * time.Millisecond)
+	if err == nil {
+		t.Fatal("The shutdown should time out.")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("The shutdown should return after the deadline, took %s", elapsed)
+	}
+	if !report.TimedOut || report.Downloads != 1 {
+		t.Fatalf("The aborted download should be reported: %s", report)
+	}
+	if sched.Status() != SCHEDULER_STATUS_CLOSED {
+		t.Fatalf("The scheduler should be closed, status %d", sched.Status())
+	}
+}
+
+func TestSchedulerRetryPutError(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<a href="/child"></a>`))
+		}
+	})
+	defer server.Close()
+	policy, err := downloader.NewRetryPolicy(3, 10*time.Millisecond, 10*time.Millisecond, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := &testItems{}
+	sched, errs := newTestScheduler(t, items, WithRetryPolicy(policy))
+	cache := &failingCache{RequestCache: sched.reqCache, fail: map[string]bool{}}
+	sched.reqCache = cache
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	// 种子已放入请求缓存，之后的重试请求放入失败。
+	cache.setFail("/", true)
+	waitIdle(t, sched)
+	waitFor(t, time.Second, "the frontier error", func() bool {
+		return len(errs.ofType(basic.FRONTIER_ERROR)) == 1
+	})
+	if server.hit("/") != 1 {
+		t.Fatalf("The request failed to be put back should not be retried, got %d hits", server.hit("/"))
+	}
+	// 未能重试的响应照常分析。
+	if server.hit("/child") != 1 || items.count() != 2 {
+		t.Fatalf("The response should be parsed, got %d child hits and %d items", server.hit("/child"), items.count())
+	}
+}
+
+func TestSchedulerNoRetryAfterDeadline(t *testing.T) {
+	policy, err := downloader.NewRetryPolicy(3, 10*time.Millisecond, 10*time.Millisecond, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sched, _ := newTestScheduler(t, &testItems{}, WithRetryPolicy(policy))
+	req := basic.NewDownloadRequest(0, newTestRequest(t, "http://example.com/"), 1)
+	// 单个请求的超时照常重试。
+	sched.ctx = context.Background()
+	if !sched.retry(req, nil, context.DeadlineExceeded) || sched.reqCache.Length() != 1 {
+		t.Fatalf("The request timeout should be retried, cache length %d", sched.reqCache.Length())
+	}
+	// 爬取的上下文超时后，正在进行的下载的失败不再重试。
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	sched.ctx = ctx
+	if sched.retry(req, nil, context.DeadlineExceeded) || sched.reqCache.Length() != 1 {
+		t.Fatalf("The request should not be retried after the crawl deadline, cache length %d",
+			sched.reqCache.Length())
+	}
+}
+
+func TestSchedulerRobotsWithCookieJar(t *testing.T) {
+	var robotsCookie atomic.Value
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			if cookie, err := r.Cookie("session"); err == nil {
+				robotsCookie.Store(cookie.Value)
+			}
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		}
+	})
+	defer server.Close()
+	jar, err := downloader.NewSessionJar("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverUrl, _ := url.Parse(server.URL)
+	jar.SetCookies(serverUrl, []*http.Cookie{{Name: "session", Value: "1"}})
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items, WithCookieJar(jar), WithRobots("testbot", 0))
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitIdle(t, sched)
+	if server.hit("/robots.txt") != 1 {
+		t.Fatalf("The robots.txt should be fetched once, got %d", server.hit("/robots.txt"))
+	}
+	if value, _ := robotsCookie.Load().(string); value != "1" {
+		t.Fatalf("The robots.txt should be fetched with the cookie jar, got cookie %q", value)
+	}
+}
+
+func TestSchedulerRobotsThroughProxy(t *testing.T) {
+	// 代理服务器直接应答经由它的请求。
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/":
+			w.Write([]byte(`<a href="/public"></a><a href="/private"></a>`))
+		}
+	})
+	defer server.Close()
+	pool, err := proxy.NewPool([]string{server.URL}, proxy.STRATEGY_ROUND_ROBIN, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items, WithProxyPool(pool), WithRobots("testbot", 0))
+	// 该主机无法解析，只有经由代理才能访问。
+	if err := sched.Start(context.Background(), newTestRequest(t, "http://crawl.example.com/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitIdle(t, sched)
+	if server.hit("/robots.txt") != 1 {
+		t.Fatalf("The robots.txt should be fetched through the proxy once, got %d", server.hit("/robots.txt"))
+	}
+	if server.hit("/public") != 1 || server.hit("/private") != 0 {
+		t.Fatalf("Unexpected hits: public %d, private %d", server.hit("/public"), server.hit("/private"))
+	}
+}
+
+// 计数的协议下载器，返回固定的页面。
+type countingFetcher struct {
+	id    uint32
+	count int32
+}
+
+func (dl *countingFetcher) Id() uint32 {
+	return dl.id
+}
+
+func (dl *countingFetcher) Download(req *basic.DownloadRequest) (*basic.DownloadRespond, error) {
+	atomic.AddInt32(&dl.count, 1)
+	respond := basic.NewDownloadResponseFor(req, &http.Response{StatusCode: 200, Request: req.HttpReq(), Body: http.NoBody})
+	respond.SetBody([]byte("local"), false)
+	return respond, nil
+}
+
+func TestSchedulerRejectsLocalSchemeFromWebPage(t *testing.T) {
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="file:///etc/passwd"></a><a href="/next"></a>`))
+		}
+	})
+	defer server.Close()
+	fetcher := &countingFetcher{}
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items, WithSchemeFetcher("file", fetcher))
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitIdle(t, sched)
+	if server.hit("/next") != 1 {
+		t.Fatalf("The http link should be crawled once, got %d", server.hit("/next"))
+	}
+	if atomic.LoadInt32(&fetcher.count) != 0 {
+		t.Fatal("The file link from a web page should be rejected.")
+	}
+	// 不是来自网页的file请求仍然可以通过Enqueue加入。
+	if err := sched.Enqueue(basic.NewDownloadRequest(0, newTestRequest(t, "file:///tmp/page.html"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	waitIdle(t, sched)
+	if atomic.LoadInt32(&fetcher.count) != 1 {
+		t.Fatalf("The enqueued file request should be fetched once, got %d", fetcher.count)
+	}
+}
+
+func TestSchedulerQueuedRedirectLimit(t *testing.T) {
+	// 每次重定向到不同的URL，只有次数限制才能终止。
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		http.Redirect(w, r, fmt.Sprintf("/loop?n=%d", n+1), http.StatusFound)
+	})
+	defer server.Close()
+	items := &testItems{}
+	sched, errs := newTestScheduler(t, items, WithRedirects(3, true))
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/loop?n=0")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitIdle(t, sched)
+	for n := 0; n <= 3; n++ {
+		if hits := server.hit(fmt.Sprintf("/loop?n=%d", n)); hits != 1 {
+			t.Fatalf("The hop %d should be requested once, got %d", n, hits)
+		}
+	}
+	if server.hit("/loop?n=4") != 0 {
+		t.Fatal("The redirect beyond the limit should not be requested.")
+	}
+	waitFor(t, time.Second, "the redirect error", func() bool {
+		return len(errs.ofType(basic.REDIRECT_ERROR)) == 1
+	})
+	if items.count() != 0 {
+		t.Fatalf("The redirect responses should not be parsed, got %d items", items.count())
+	}
+}
+
+// 请求没有令牌时设置令牌并要求重新调度的中间件。
+type tokenMiddleware struct {
+	downloader.BaseMiddleware
+}
+
+func (mw *tokenMiddleware) ProcessRequest(req *basic.DownloadRequest) (*basic.DownloadRequest, *basic.DownloadRespond, error) {
+	httpReq := req.HttpReq()
+	if httpReq.Header.Get("X-Token") != "" {
+		return req, nil, nil
+	}
+	if httpReq.URL.Path == "/inplace" {
+		httpReq.Header.Set("X-Token", "inplace")
+		return nil, nil, downloader.NewRescheduleError(req, 0)
+	}
+	tokenReq := *httpReq
+	tokenReq.Header = httpReq.Header.Clone()
+	tokenReq.Header.Set("X-Token", "replaced")
+	return nil, nil, downloader.NewRescheduleError(req.WithHttpReq(&tokenReq), 0)
+}
+
+func TestSchedulerRescheduleKeepsHeaders(t *testing.T) {
+	var lock sync.Mutex
+	tokens := map[string]string{}
+	server := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		tokens[r.URL.Path] = r.Header.Get("X-Token")
+		lock.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/inplace"></a>`))
+		}
+	})
+	defer server.Close()
+	items := &testItems{}
+	sched, _ := newTestScheduler(t, items, WithDownloaderMiddlewares(&tokenMiddleware{}))
+	if err := sched.Start(context.Background(), newTestRequest(t, server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	defer sched.Stop()
+	waitIdle(t, sched)
+	lock.Lock()
+	defer lock.Unlock()
+	if tokens["/"] != "replaced" || tokens["/inplace"] != "inplace" {
+		t.Fatalf("The rescheduled requests should keep the middleware headers, got %v", tokens)
+	}
+	if server.hit("/") != 1 || server.hit("/inplace") != 1 {
+		t.Fatalf("Unexpected hits: %d, %d", server.hit("/"), server.hit("/inplace"))
+	}
+}
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 优雅关闭时检查在途工作的间隔。
+const drainCheckInterval = 10 * time.Millisecond
+
+// 优雅关闭的报告，记录关闭时被放弃的工作。
+type ShutdownReport struct {
+	TimedOut        bool   // 是否等待超时。
+	PendingRequests uint64 // 尚未下载的请求数，使用持久化的爬取边界时可通过Restore继续。
+	Downloads       uint64 // 被中止的下载数。
+	Responses       uint64 // 尚未分析完毕的响应数。
+	Items           uint64 // 尚未处理完毕的条目数。
+}
+
+func (report ShutdownReport) String() string {
+	return fmt.Sprintf("timedOut: %v, pendingRequests: %d, downloads: %d, responses: %d, items: %d",
+		report.TimedOut, report.PendingRequests, report.Downloads, report.Responses, report.Items)
+}
+
+// 优雅关闭：不再开始新的下载，等待正在进行的下载、分析与条目处理完成后再停止调度器。
+// 分析得到的新请求仍会放入请求缓存，使用持久化的爬取边界时不会丢失。
+// timeout为0时一直等待，超时则中止剩余的工作并在报告中列出。
+func (sched *schedulerImpl) Shutdown(timeout time.Duration) (ShutdownReport, error) {
+	if sched.stopSign.IsSigned() {
+		return ShutdownReport{}, errors.New("The scheduler has been stoped.")
+	}
+	if !atomic.CompareAndSwapUint32(&sched.draining, 0, 1) {
+		return ShutdownReport{}, errors.New("The scheduler is already shutting down.")
+	}
+	deadline := time.Now().Add(timeout)
+	timedOut := false
+	for !sched.drained() {
+		if sched.stopSign.IsSigned() {
+			break
+		}
+		if timeout > 0 && time.Now().After(deadline) {
+			timedOut = true
+			break
+		}
+		time.Sleep(drainCheckInterval)
+	}
+	report := sched.shutdownReport(timedOut)
+	sched.Stop()
+	if timedOut {
+		return report, fmt.Errorf("The shutdown timed out after %s. (%s)", timeout, report)
+	}
+	return report, nil
+}
+
+// 判断调度器是否正在优雅关闭。
+func (sched *schedulerImpl) isDraining() bool {
+	return atomic.LoadUint32(&sched.draining) == 1
+}
+
+// 判断在途的下载、分析与条目处理是否都已完成。
+func (sched *schedulerImpl) drained() bool {
+	return atomic.LoadInt64(&sched.downloading) == 0 &&
+		atomic.LoadInt64(&sched.parsing) == 0 &&
+		atomic.LoadInt64(&sched.processing) == 0
+}
+
+func (sched *schedulerImpl) shutdownReport(timedOut bool) ShutdownReport {
+	pending := uint64(sched.reqCache.Length()) + uint64(sched.throttle.Buffered()) +
+		atomic.LoadUint64(&sched.skipped)
+	if reqChan, err := sched.channelManager.ReqChan(); err == nil {
+		pending += uint64(len(reqChan))
+	}
+	return ShutdownReport{
+		TimedOut:        timedOut,
+		PendingRequests: pending,
+		Downloads:       uint64(atomic.LoadInt64(&sched.downloading)),
+		Responses:       uint64(atomic.LoadInt64(&sched.parsing)),
+		Items:           uint64(atomic.LoadInt64(&sched.processing)),
+	}
+}
@@ -1,9 +1,9 @@
 package scheduler
 
 import (
-	//"bytes"
 	"fmt"
 	"chaoshen.com/crawlergo/crawler/basic"
+	"sync/atomic"
 )
 
 // 调度器摘要信息的接口类型。
@@ -18,40 +18,39 @@ func NewSchedSummary(sched *schedulerImpl, prefix string) SchedSummary {
 	if sched == nil {
 		return nil
 	}
-	//urlCount := len(sched.urlMap)
-	var urlDetail string
-	/*
-	if urlCount > 0 {
-		var buffer bytes.Buffer
-		buffer.WriteByte('\n')
-		for k, _ := range sched.urlMap {
-			buffer.WriteString(prefix)
-			buffer.WriteString(prefix)
-			buffer.WriteString(k)
-			buffer.WriteByte('\n')
-		}
-		urlDetail = buffer.String()
-	} else {
-	*/
-		urlDetail = "\n"
-	//}
-	return &schedSummaryImpl{
+	// 去重过滤器只记录URL的键，不再列出已请求的URL。
+	urlDetail := "\n"
+	summary := &schedSummaryImpl{
 		prefix:              prefix,
-		status:              sched.status,
+		status:              atomic.LoadUint32(&sched.status),
 		channelConfig:       sched.channelConfig,
 		poolBaseConfig:      sched.poolBaseConfig,
 		crawMaxDepth:         sched.crawMaxDepth,
 		chanManSummary:      sched.channelManager.Summary(),
 		reqCacheSummary:     sched.reqCache.Summary(),
+		throttleSummary:     sched.throttle.Summary(),
 		dlPoolLen:           sched.dlPool.Used(),
 		dlPoolCap:           sched.dlPool.Total(),
 		analyzerPoolLen:     sched.parserPool.Used(),
 		analyzerPoolCap:     sched.parserPool.Total(),
 		itemPipelineSummary: sched.itemPipeline.Summary(),
-		urlCount:            0,
+		urlCount:            int(sched.dupeFilter.Count()),
+		dupeFilterSummary:   sched.dupeFilter.Summary(),
+		dupeFilterMemory:    sched.dupeFilter.MemoryUsage(),
 		urlDetail:           urlDetail,
 		stopSignSummary:     sched.stopSign.Summary(),
 	}
+	if sched.cookieJar != nil {
+		summary.cookieJarSummary = sched.cookieJar.Summary()
+	}
+	summary.timingSummary = sched.timings.Summary()
+	if sched.warcWriter != nil {
+		summary.warcSummary = sched.warcWriter.Summary()
+	}
+	if sched.proxyPool != nil {
+		summary.proxySummary = sched.proxyPool.Summary()
+	}
+	return summary
 }
 
 // 调度器摘要信息的实现类型。
@@ -63,14 +62,21 @@ type schedSummaryImpl struct {
 	crawMaxDepth        uint32            // 爬取的最大深度。
 	chanManSummary      string            // 通道管理器的摘要信息。
 	reqCacheSummary     string            // 请求缓存的摘要信息。
+	throttleSummary     string            // 按主机限流的摘要信息。
 	dlPoolLen           uint32            // 网页下载器池的长度。
 	dlPoolCap           uint32            // 网页下载器池的容量。
 	analyzerPoolLen     uint32            // 分析器池的长度。
 	analyzerPoolCap     uint32            // 分析器池的容量。
 	itemPipelineSummary string            // 条目处理管道的摘要信息。
 	urlCount            int               // 已请求的URL的计数。
+	dupeFilterSummary   string            // 去重过滤器的摘要信息。
+	dupeFilterMemory    uint64            // 去重过滤器占用内存的估计字节数。
 	urlDetail           string            // 已请求的URL的详细信息。
 	stopSignSummary     string            // 停止信号的摘要信息。
+	cookieJarSummary    string            // Cookie容器的摘要信息。
+	proxySummary        string            // 代理池的摘要信息。
+	warcSummary         string            // WARC归档的摘要信息。
+	timingSummary       string            // 按主机汇总的网络耗时。
 }
 
 func (ss *schedSummaryImpl) String() string {
@@ -85,25 +91,34 @@ func (ss *schedSummaryImpl) Detail() string {
 func (ss *schedSummaryImpl) getSummary(detail bool) string {
 	prefix := ss.prefix
 	template := prefix + "Running: %v \n" +
+		prefix + "Paused: %v \n" +
 		prefix + "Channel config: %s \n" +
 		prefix + "Pool base config: %s \n" +
 		prefix + "Crawl depth: %d \n" +
 		prefix + "Channels manager: %s \n" +
 		prefix + "Request cache: %s\n" +
+		prefix + "Politeness: %s\n" +
 		prefix + "Downloader pool: %d/%d\n" +
 		prefix + "parser pool: %d/%d\n" +
 		prefix + "Item pipeline: %s\n" +
 		prefix + "Urls(%d): %s" +
+		prefix + "Dupe filter: %s, memory: %d bytes\n" +
+		prefix + "Cookie jar: %s\n" +
+		prefix + "Proxies: %s\n" +
+		prefix + "WARC: %s\n" +
+		prefix + "Network timing: %s\n" +
 		prefix + "Stop sign: %s\n"
 	return fmt.Sprintf(template,
 		func() bool {
 			return ss.status == SCHEDULER_STATUS_RUNNING
 		}(),
+		ss.status == SCHEDULER_STATUS_PAUSED,
 		ss.channelConfig.Summary(),
 		ss.poolBaseConfig.Summary(),
 		ss.crawMaxDepth,
 		ss.chanManSummary,
 		ss.reqCacheSummary,
+		ss.throttleSummary,
 		ss.dlPoolLen, ss.dlPoolCap,
 		ss.analyzerPoolLen, ss.analyzerPoolCap,
 		ss.itemPipelineSummary,
@@ -115,6 +130,26 @@ func (ss *schedSummaryImpl) getSummary(detail bool) string {
 				return "<concealed>\n"
 			}
 		}(),
+		ss.dupeFilterSummary, ss.dupeFilterMemory,
+		func() string {
+			if ss.cookieJarSummary == "" {
+				return "<none>"
+			}
+			return ss.cookieJarSummary
+		}(),
+		func() string {
+			if ss.proxySummary == "" {
+				return "<none>"
+			}
+			return ss.proxySummary
+		}(),
+		func() string {
+			if ss.warcSummary == "" {
+				return "<none>"
+			}
+			return ss.warcSummary
+		}(),
+		ss.timingSummary,
 		ss.stopSignSummary)
 }
 
@@ -133,8 +168,14 @@ func (ss *schedSummaryImpl) Same(other SchedSummary) bool {
 		ss.analyzerPoolLen != otherSs.analyzerPoolLen ||
 		ss.analyzerPoolCap != otherSs.analyzerPoolCap ||
 		ss.urlCount != otherSs.urlCount ||
+		ss.dupeFilterSummary != otherSs.dupeFilterSummary ||
 		ss.stopSignSummary != otherSs.stopSignSummary ||
 		ss.reqCacheSummary != otherSs.reqCacheSummary ||
+		ss.throttleSummary != otherSs.throttleSummary ||
+		ss.cookieJarSummary != otherSs.cookieJarSummary ||
+		ss.proxySummary != otherSs.proxySummary ||
+		ss.warcSummary != otherSs.warcSummary ||
+		ss.timingSummary != otherSs.timingSummary ||
 		ss.poolBaseConfig.Summary() != otherSs.poolBaseConfig.Summary() ||
 		ss.channelConfig.Summary() != otherSs.channelConfig.Summary() ||
 		ss.itemPipelineSummary != otherSs.itemPipelineSummary ||
@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"chaoshen.com/crawlergo/crawler/basic"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 摘要信息中列出的最慢的主机数。
+const timingSummaryHosts = 10
+
+// 单个主机的网络耗时统计。
+type hostTiming struct {
+	host      string
+	count     int64
+	reused    int64 // 复用连接的次数。
+	dns       time.Duration
+	connect   time.Duration
+	tls       time.Duration
+	firstByte time.Duration
+	total     time.Duration
+	maxTotal  time.Duration
+}
+
+func (ht *hostTiming) avg(sum time.Duration) time.Duration {
+	return sum / time.Duration(ht.count)
+}
+
+// 按主机汇总的网络耗时，用于区分慢的站点与自身的网络问题。
+type hostTimings struct {
+	lock  sync.Mutex
+	hosts map[string]*hostTiming
+}
+
+func newHostTimings() *hostTimings {
+	return &hostTimings{hosts: map[string]*hostTiming{}}
+}
+
+// 记录一次下载的网络耗时。
+func (timings *hostTimings) Record(host string, timing basic.NetworkTiming) {
+	timings.lock.Lock()
+	defer timings.lock.Unlock()
+	ht, ok := timings.hosts[host]
+	if !ok {
+		ht = &hostTiming{host: host}
+		timings.hosts[host] = ht
+	}
+	ht.count++
+	if timing.ConnReused {
+		ht.reused++
+	}
+	ht.dns += timing.DNS
+	ht.connect += timing.Connect
+	ht.tls += timing.TLSHandshake
+	ht.firstByte += timing.FirstByte
+	ht.total += timing.Total
+	if timing.Total > ht.maxTotal {
+		ht.maxTotal = timing.Total
+	}
+}
+
+// 获得摘要信息：所有主机的平均耗时，以及平均总耗时最长的若干主机的平均耗时。
+func (timings *hostTimings) Summary() string {
+	timings.lock.Lock()
+	defer timings.lock.Unlock()
+	if len(timings.hosts) == 0 {
+		return "<none>"
+	}
+	all := &hostTiming{host: "all"}
+	hosts := make([]*hostTiming, 0, len(timings.hosts))
+	for _, ht := range timings.hosts {
+		hosts = append(hosts, ht)
+		all.count += ht.count
+		all.reused += ht.reused
+		all.dns += ht.dns
+		all.connect += ht.connect
+		all.tls += ht.tls
+		all.firstByte += ht.firstByte
+		all.total += ht.total
+		if ht.maxTotal > all.maxTotal {
+			all.maxTotal = ht.maxTotal
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].avg(hosts[i].total) > hosts[j].avg(hosts[j].total)
+	})
+	if len(hosts) > timingSummaryHosts {
+		hosts = hosts[:timingSummaryHosts]
+	}
+	lines := []string{formatHostTiming(all)}
+	for _, ht := range hosts {
+		lines = append(lines, formatHostTiming(ht))
+	}
+	return strings.Join(lines, "; ")
+}
+
+func formatHostTiming(ht *hostTiming) string {
+	round := func(d time.Duration) time.Duration {
+		return d.Round(time.Millisecond / 10)
+	}
+	return fmt.Sprintf("%s(n=%d, reused=%d, dns=%s, connect=%s, tls=%s, ttfb=%s, total=%s, max=%s)",
+		ht.host, ht.count, ht.reused,
+		round(ht.avg(ht.dns)), round(ht.avg(ht.connect)), round(ht.avg(ht.tls)),
+		round(ht.avg(ht.firstByte)), round(ht.avg(ht.total)), round(ht.maxTotal))
+}
@@ -0,0 +1,142 @@
+package util
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// 默认去除的跟踪参数与会话参数，以'*'结尾的参数名按前缀匹配。
+var DefaultStripParams = []string{
+	"utm_*",
+	"gclid",
+	"fbclid",
+	"spm",
+	"jsessionid",
+	"phpsessid",
+	"aspsessionid*",
+	"sessionid",
+}
+
+// 默认端口。
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// URL规范化器，使同一页面的不同写法得到相同的结果。
+type URLCanonicalizer struct {
+	stripParams []string // 小写的需要去除的参数名。
+}
+
+// 创建URL规范化器，stripParams为需要去除的查询参数名（不区分大小写），
+// 以'*'结尾的参数名按前缀匹配。
+func NewURLCanonicalizer(stripParams ...string) *URLCanonicalizer {
+	params := make([]string, 0, len(stripParams))
+	for _, param := range stripParams {
+		if param = strings.ToLower(strings.TrimSpace(param)); param != "" {
+			params = append(params, param)
+		}
+	}
+	return &URLCanonicalizer{stripParams: params}
+}
+
+// 判断参数是否需要去除。
+func (c *URLCanonicalizer) strip(name string) bool {
+	name = strings.ToLower(name)
+	for _, param := range c.stripParams {
+		if strings.HasSuffix(param, "*") {
+			if strings.HasPrefix(name, param[:len(param)-1]) {
+				return true
+			}
+		} else if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// 规范化URL：小写协议与主机名，去除默认端口与片段，
+// 去除需要去除的查询参数及路径参数（如;jsessionid=...），并按参数名排序查询参数。
+func (c *URLCanonicalizer) Canonicalize(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	result := *u
+	result.Scheme = strings.ToLower(result.Scheme)
+	result.Fragment = ""
+	if result.Opaque != "" {
+		return result.String()
+	}
+	host := strings.ToLower(result.Host)
+	if port := result.Port(); port != "" && defaultPorts[result.Scheme] == port {
+		host = strings.TrimSuffix(host, ":"+port)
+	}
+	result.Host = host
+	if result.Path == "" && result.Host != "" {
+		result.Path = "/"
+	}
+	result.Path = c.stripPathParams(result.Path)
+	result.RawPath = ""
+	result.RawQuery = c.canonicalQuery(result.RawQuery)
+	result.ForceQuery = false
+	return result.String()
+}
+
+// 去除路径参数中需要去除的参数，例如/a;jsessionid=123。
+func (c *URLCanonicalizer) stripPathParams(path string) string {
+	if !strings.Contains(path, ";") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		parts := strings.Split(segment, ";")
+		kept := parts[:1]
+		for _, part := range parts[1:] {
+			name := part
+			if index := strings.Index(part, "="); index >= 0 {
+				name = part[:index]
+			}
+			if !c.strip(name) {
+				kept = append(kept, part)
+			}
+		}
+		segments[i] = strings.Join(kept, ";")
+	}
+	return strings.Join(segments, "/")
+}
+
+// 去除需要去除的查询参数，并按参数名排序，同名参数保持原有顺序。
+func (c *URLCanonicalizer) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	pairs := make([]string, 0)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name := pair
+		if index := strings.Index(pair, "="); index >= 0 {
+			name = pair[:index]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if c.strip(name) {
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return queryName(pairs[i]) < queryName(pairs[j])
+	})
+	return strings.Join(pairs, "&")
+}
+
+func queryName(pair string) string {
+	if index := strings.Index(pair, "="); index >= 0 {
+		return pair[:index]
+	}
+	return pair
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestURLCanonicalizer(t *testing.T) {
+	canonicalizer := NewURLCanonicalizer(DefaultStripParams...)
+	cases := []struct {
+		raw      string
+		expected string
+	}{
+		{"http://A.com/x#top", "http://a.com/x"},
+		{"http://a.com:80/x", "http://a.com/x"},
+		{"https://a.com:443", "https://a.com/"},
+		{"http://a.com:8080/x", "http://a.com:8080/x"},
+		{"http://a.com/x?b=2&a=1", "http://a.com/x?a=1&b=2"},
+		{"http://a.com/x?a=1&b=2&utm_source=t&UTM_medium=m", "http://a.com/x?a=1&b=2"},
+		{"http://a.com/x;jsessionid=123?PHPSESSID=1&a=1", "http://a.com/x?a=1"},
+		{"http://a.com/x?a=2&a=1", "http://a.com/x?a=2&a=1"},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := canonicalizer.Canonicalize(u); result != c.expected {
+			t.Errorf("Canonicalize(%s) = %s, expected %s.", c.raw, result, c.expected)
+		}
+	}
+}
@@ -125,6 +125,8 @@ func (cmi *channelManagerImpl)ErrorChan() (chan error,error){
 }
 
 func (cmi *channelManagerImpl)Status () ChannelManagerStatus{
+	cmi.RLock()
+	defer cmi.RUnlock()
 	return cmi.status
 }
 
@@ -150,6 +152,8 @@ var chanmanSummaryTemplate = "status: %s, " +
 	"errorChannel: %d/%d"
 
 func (cmi *channelManagerImpl)Summary() string{
+	cmi.RLock()
+	defer cmi.RUnlock()
 	summary := fmt.Sprintf(chanmanSummaryTemplate,
 		statusNameMap[cmi.status],
 		len(cmi.reqChan), cap(cmi.reqChan),
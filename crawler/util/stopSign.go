@@ -29,7 +29,7 @@ func  NewStopSign () StopSign {
 func (ssi *StopSignImpl)SignStop() bool{
 	ssi.Lock()
 	defer ssi.Unlock()
-	if ssi.IsSigned() {
+	if ssi.signed {
 		return false
 	}
 	ssi.signed=true
@@ -37,6 +37,8 @@ func (ssi *StopSignImpl)SignStop() bool{
 }
 
 func (ssi *StopSignImpl)IsSigned() bool{
+	ssi.RLock()
+	defer ssi.RUnlock()
 	return ssi.signed
 }
 
@@ -78,6 +80,8 @@ func (ssi *StopSignImpl)RecordTotal ()uint {
 
 
 func (ssi *StopSignImpl) Summary() string {
+	ssi.RLock()
+	defer ssi.RUnlock()
 	if ssi.signed {
 		return fmt.Sprintf("signed: true, recodeCountMap: %v", ssi.recodeCountMap)
 	} else {
@@ -0,0 +1,206 @@
+package warc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 记录在WARC文件中的位置。
+type Position struct {
+	Offset int64 // 压缩文件中记录所在gzip成员的起始位置，未压缩文件中记录的起始位置。
+	Index  int   // 记录在gzip成员中的序号，未压缩文件中总是0。
+}
+
+// WARC文件的读取器，支持每条记录单独压缩、整个文件压缩以及未压缩的文件。
+type Reader struct {
+	counter    *countingReader
+	buf        *bufio.Reader
+	compressed bool
+	gzip       *gzip.Reader
+	member     *bufio.Reader // 当前gzip成员解压后的内容。
+	position   Position      // 下一条记录的位置。
+	started    bool
+}
+
+// 创建WARC文件的读取器，r从记录的起始位置开始，根据gzip的魔数判断是否压缩。
+// base为r在文件中的起始位置，用于计算记录的位置。
+func NewReader(r io.Reader, base int64) (*Reader, error) {
+	counter := &countingReader{reader: r, count: base}
+	buf := bufio.NewReader(counter)
+	magic, err := buf.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	reader := &Reader{counter: counter, buf: buf}
+	reader.compressed = len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+	return reader, nil
+}
+
+// 读取下一条记录及其位置，没有更多记录时返回io.EOF。
+func (reader *Reader) Next() (*Record, Position, error) {
+	if !reader.compressed {
+		position := Position{Offset: reader.offset()}
+		rec, err := readRecord(reader.buf)
+		return rec, position, err
+	}
+	for {
+		if reader.member != nil {
+			if _, err := reader.member.Peek(1); err == nil {
+				position := reader.position
+				rec, err := readRecord(reader.member)
+				reader.position.Index++
+				return rec, position, err
+			} else if err != io.EOF {
+				return nil, Position{}, err
+			}
+		}
+		if err := reader.nextMember(); err != nil {
+			return nil, Position{}, err
+		}
+	}
+}
+
+// 开始读取下一个gzip成员。
+func (reader *Reader) nextMember() error {
+	reader.position = Position{Offset: reader.offset()}
+	var err error
+	if !reader.started {
+		reader.gzip, err = gzip.NewReader(reader.buf)
+		reader.started = true
+	} else {
+		err = reader.gzip.Reset(reader.buf)
+	}
+	if err != nil {
+		return err
+	}
+	reader.gzip.Multistream(false)
+	reader.member = bufio.NewReader(reader.gzip)
+	return nil
+}
+
+// 当前在底层读取器中的位置。
+func (reader *Reader) offset() int64 {
+	return reader.counter.count - int64(reader.buf.Buffered())
+}
+
+// 读取位于position的记录，r从文件的起始位置开始，需要支持Seek。
+func ReadAt(r io.ReadSeeker, position Position) (*Record, error) {
+	if _, err := r.Seek(position.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader, err := NewReader(r, position.Offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; ; i++ {
+		rec, current, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if current.Offset != position.Offset {
+			return nil, errors.New("The warc record is not found at the position.")
+		}
+		if i == position.Index {
+			return rec, nil
+		}
+	}
+}
+
+// 读取时允许的最大记录内容长度，超过时视为文件损坏。
+const MaxBlockSize int64 = 1 << 30
+
+// 读取一条记录，没有更多记录时返回io.EOF。
+func readRecord(r *bufio.Reader) (*Record, error) {
+	// 跳过记录之间的空行。
+	var line string
+	for {
+		var err error
+		line, err = r.ReadString('\n')
+		if err == io.EOF && strings.TrimSpace(line) == "" {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			break
+		}
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("Invalid warc version line: %q", line)
+	}
+	rec := &Record{}
+	contentLength := int64(-1)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		index := strings.Index(line, ":")
+		if index < 0 {
+			return nil, fmt.Errorf("Invalid warc header line: %q", line)
+		}
+		name, value := strings.TrimSpace(line[:index]), strings.TrimSpace(line[index+1:])
+		switch strings.ToLower(name) {
+		case "warc-type":
+			rec.Type = value
+		case "warc-record-id":
+			rec.ID = value
+		case "warc-date":
+			rec.Date, _ = time.Parse(time.RFC3339, value)
+		case "warc-target-uri":
+			rec.TargetURI = value
+		case "content-type":
+			rec.ContentType = value
+		case "content-length":
+			if contentLength, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("Invalid warc content length: %q", value)
+			}
+		default:
+			rec.Fields = append(rec.Fields, Field{Name: name, Value: value})
+		}
+	}
+	if contentLength < 0 {
+		return nil, errors.New("The warc record has no content length.")
+	}
+	if contentLength > MaxBlockSize {
+		return nil, fmt.Errorf("The warc content length %d exceeds %d bytes.", contentLength, MaxBlockSize)
+	}
+	// 按实际读到的内容分配，损坏的文件不会因虚报的长度分配大块内存。
+	block, err := ioutil.ReadAll(io.LimitReader(r, contentLength))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(block)) < contentLength {
+		return nil, io.ErrUnexpectedEOF
+	}
+	rec.Block = block
+	// 记录以两个CRLF结束。
+	if _, err := io.CopyN(ioutil.Discard, r, 4); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// 统计读取字节数的读取器。
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,63 @@
+package warc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestReaderUncompressed(t *testing.T) {
+	var buf bytes.Buffer
+	for _, target := range []string{"http://a.com/1", "http://a.com/2"} {
+		rec := &Record{Type: TYPE_RESPONSE, TargetURI: target, Block: []byte("HTTP/1.1 200 OK\r\n\r\n" + target)}
+		if err := rec.writeTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := NewReader(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var positions []Position
+	for {
+		rec, position, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Type != TYPE_RESPONSE || rec.Field("WARC-Block-Digest") != Digest(rec.Block) {
+			t.Fatalf("Unexpected record: %+v", rec)
+		}
+		positions = append(positions, position)
+	}
+	if len(positions) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(positions))
+	}
+	rec, err := ReadAt(bytes.NewReader(buf.Bytes()), positions[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.TargetURI != "http://a.com/2" {
+		t.Fatalf("Unexpected record at %+v: %s", positions[1], rec.TargetURI)
+	}
+}
+
+func TestReaderContentLength(t *testing.T) {
+	cases := map[string]int64{
+		"oversize":  MaxBlockSize + 1,
+		"truncated": 100,
+	}
+	for name, length := range cases {
+		data := fmt.Sprintf("WARC/1.0\r\nWARC-Type: response\r\nContent-Length: %d\r\n\r\nshort", length)
+		reader, err := NewReader(bytes.NewReader([]byte(data)), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := reader.Next(); err == nil || err == io.EOF {
+			t.Errorf("Expected an error for the %s record, got %v.", name, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package warc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WARC记录的类型。
+const (
+	TYPE_WARCINFO = "warcinfo"
+	TYPE_REQUEST  = "request"
+	TYPE_RESPONSE = "response"
+	TYPE_METADATA = "metadata"
+)
+
+// 响应因下载限制被拒绝时，response记录中记录拒绝原因的字段，回放时不使用这样的响应。
+const FIELD_REJECTED = "Crawler-Rejected"
+
+// WARC的版本行。
+const version = "WARC/1.0"
+
+// WARC记录头或warcinfo内容中的一个字段。
+type Field struct {
+	Name  string
+	Value string
+}
+
+// 一条WARC记录。
+type Record struct {
+	Type        string    // 记录类型。
+	ID          string    // 记录ID，形如<urn:uuid:...>，为空时写入前自动生成。
+	Date        time.Time // 记录的时间，零值时写入前使用当前时间。
+	TargetURI   string    // 记录对应的URL。
+	ContentType string    // 内容块的类型。
+	Fields      []Field   // 其他记录头字段。
+	Block       []byte    // 内容块。
+}
+
+// 获得记录头字段的值，不区分大小写，不存在时返回空字符串。
+func (rec *Record) Field(name string) string {
+	for _, field := range rec.Fields {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// 将记录按WARC格式写入w，不包括压缩。
+func (rec *Record) writeTo(w io.Writer) error {
+	if rec.ID == "" {
+		rec.ID = NewRecordID()
+	}
+	if rec.Date.IsZero() {
+		rec.Date = time.Now()
+	}
+	var buf bytes.Buffer
+	buf.WriteString(version + "\r\n")
+	writeField(&buf, "WARC-Type", rec.Type)
+	writeField(&buf, "WARC-Record-ID", rec.ID)
+	writeField(&buf, "WARC-Date", rec.Date.UTC().Format(time.RFC3339))
+	if rec.TargetURI != "" {
+		writeField(&buf, "WARC-Target-URI", rec.TargetURI)
+	}
+	for _, field := range rec.Fields {
+		writeField(&buf, field.Name, field.Value)
+	}
+	writeField(&buf, "WARC-Block-Digest", Digest(rec.Block))
+	if rec.ContentType != "" {
+		writeField(&buf, "Content-Type", rec.ContentType)
+	}
+	writeField(&buf, "Content-Length", strconv.Itoa(len(rec.Block)))
+	buf.WriteString("\r\n")
+	buf.Write(rec.Block)
+	buf.WriteString("\r\n\r\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeField(buf *bytes.Buffer, name string, value string) {
+	// 字段值中不允许出现换行。
+	value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+	buf.WriteString(name + ": " + value + "\r\n")
+}
+
+// 生成记录ID。
+func NewRecordID() string {
+	var uuid [16]byte
+	rand.Read(uuid[:])
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// 计算内容的摘要，形如sha1:BASE32。
+func Digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// 创建warcinfo记录，fields为描述爬取配置的字段。
+func NewInfoRecord(filename string, fields []Field) *Record {
+	var buf bytes.Buffer
+	for _, field := range fields {
+		writeField(&buf, field.Name, field.Value)
+	}
+	return &Record{
+		Type:        TYPE_WARCINFO,
+		ContentType: "application/warc-fields",
+		Fields:      []Field{{Name: "WARC-Filename", Value: filename}},
+		Block:       buf.Bytes(),
+	}
+}
+
+// 创建metadata记录，内容块为fields，如下载失败的原因。
+func NewMetadataRecord(targetURI string, fields []Field, date time.Time) *Record {
+	var buf bytes.Buffer
+	for _, field := range fields {
+		writeField(&buf, field.Name, field.Value)
+	}
+	return &Record{
+		Type:        TYPE_METADATA,
+		Date:        date,
+		TargetURI:   targetURI,
+		ContentType: "application/warc-fields",
+		Block:       buf.Bytes(),
+	}
+}
+
+// 创建request记录，内容块为HTTP请求行、请求头与请求体，body为nil时没有请求体。
+func NewRequestRecord(req *http.Request, body []byte, date time.Time) *Record {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+	writeHeader(&buf, req.Header)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return &Record{
+		Type:        TYPE_REQUEST,
+		Date:        date,
+		TargetURI:   req.URL.String(),
+		ContentType: "application/http;msgtype=request",
+		Block:       buf.Bytes(),
+	}
+}
+
+// 创建response记录，内容块为HTTP状态行、响应头与响应体。
+// 响应体已被解压，因此不写入Content-Encoding与Transfer-Encoding，Content-Length为实际的长度；
+// 被截断的响应体带有WARC-Truncated: length字段。
+func NewResponseRecord(resp *http.Response, body []byte, truncated bool, date time.Time) *Record {
+	header := make(http.Header, len(resp.Header))
+	for key, values := range resp.Header {
+		header[key] = values
+	}
+	header.Del("Content-Encoding")
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	var buf bytes.Buffer
+	status := resp.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	fmt.Fprintf(&buf, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, status)
+	writeHeader(&buf, header)
+	buf.WriteString("\r\n")
+	httpHeaderLen := buf.Len()
+	buf.Write(body)
+	rec := &Record{
+		Type:        TYPE_RESPONSE,
+		Date:        date,
+		ContentType: "application/http;msgtype=response",
+		Fields:      []Field{{Name: "WARC-Payload-Digest", Value: Digest(buf.Bytes()[httpHeaderLen:])}},
+		Block:       buf.Bytes(),
+	}
+	if resp.Request != nil && resp.Request.URL != nil {
+		rec.TargetURI = resp.Request.URL.String()
+	}
+	if truncated {
+		rec.Fields = append(rec.Fields, Field{Name: "WARC-Truncated", Value: "length"})
+	}
+	return rec
+}
+
+// 按名称顺序写入HTTP头。
+func writeHeader(buf *bytes.Buffer, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			writeField(buf, key, value)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package warc
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WARC文件写入器的接口类型。
+type Writer interface {
+	// 依次写入记录，同一次写入的记录总是位于同一个文件中。
+	WriteRecords(records ...*Record) error
+	Close() error
+	Summary() string // 获得摘要信息。
+}
+
+// 按大小轮换文件的WARC写入器，每条记录单独以gzip压缩。
+type rotatingWriter struct {
+	lock    sync.Mutex
+	dir     string
+	prefix  string
+	maxSize int64   // 单个文件的大小上限，超过后轮换到新文件。
+	info    []Field // 每个文件开头的warcinfo记录的内容。
+	file    *os.File
+	size    int64 // 当前文件已写入的字节数。
+	serial  int   // 已创建的文件数。
+	records uint64
+	infoID  string // 当前文件的warcinfo记录ID。
+	closed  bool
+}
+
+// 创建WARC写入器，文件保存在dir中，命名为prefix-时间-序号.warc.gz。
+// 文件大小超过maxSize后轮换到新文件，每个文件以描述爬取配置的warcinfo记录开头。
+func NewWriter(dir string, prefix string, maxSize int64, info []Field) (Writer, error) {
+	if dir == "" || prefix == "" {
+		return nil, errors.New("The warc directory and prefix can not be empty.")
+	}
+	if maxSize <= 0 {
+		return nil, errors.New("The max size of warc file must be positive.")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &rotatingWriter{dir: dir, prefix: prefix, maxSize: maxSize, info: info}, nil
+}
+
+func (w *rotatingWriter) WriteRecords(records ...*Record) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return errors.New("The warc writer has been closed.")
+	}
+	if w.file == nil || w.size >= w.maxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	for _, rec := range records {
+		if w.infoID != "" && rec.Type != TYPE_WARCINFO && rec.Field("WARC-Warcinfo-ID") == "" {
+			rec.Fields = append(rec.Fields, Field{Name: "WARC-Warcinfo-ID", Value: w.infoID})
+		}
+		if err := w.write(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 关闭当前文件并创建新文件，写入warcinfo记录。
+func (w *rotatingWriter) rotate() error {
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	w.serial++
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix, time.Now().UTC().Format("20060102150405"), w.serial)
+	file, err := os.OpenFile(filepath.Join(w.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.size = 0
+	info := NewInfoRecord(name, w.info)
+	if err := w.write(info); err != nil {
+		return err
+	}
+	w.infoID = info.ID
+	return nil
+}
+
+// 以单独的gzip成员写入一条记录。
+func (w *rotatingWriter) write(rec *Record) error {
+	counter := &countingWriter{file: w.file}
+	gzipWriter := gzip.NewWriter(counter)
+	if err := rec.writeTo(gzipWriter); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	w.size += counter.count
+	w.records++
+	return nil
+}
+
+func (w *rotatingWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *rotatingWriter) Summary() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return fmt.Sprintf("dir: %s, files: %d, records: %d, maxSize: %d",
+		w.dir, w.serial, w.records, w.maxSize)
+}
+
+// 统计写入字节数的写入器。
+type countingWriter struct {
+	file  *os.File
+	count int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.file.Write(p)
+	cw.count += int64(n)
+	return n, err
+}
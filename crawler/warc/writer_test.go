@@ -0,0 +1,104 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writer, err := NewWriter(dir, "test", 300, []Field{{Name: "software", Value: "crawlergo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", "http://www.a.com/page?x=1", nil)
+	req.Header.Set("User-Agent", "crawlergo")
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"gzip"}},
+		Request:    req,
+	}
+	for i := 0; i < 3; i++ {
+		respRecord := NewResponseRecord(resp, []byte("<html>hello</html>"), i == 2, time.Now())
+		reqRecord := NewRequestRecord(req, nil, time.Now())
+		if err := writer.WriteRecords(respRecord, reqRecord); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "test-*.warc.gz"))
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 rotated files, got %d", len(files))
+	}
+	file, err := os.Open(files[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	// 每条记录是单独的gzip成员。
+	buffered := bufio.NewReader(file)
+	reader, err := gzip.NewReader(buffered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var members []string
+	for {
+		reader.Multistream(false)
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, reader); err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, buf.String())
+		if err := reader.Reset(buffered); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(members) != 3 {
+		t.Fatalf("Expected 3 gzip members, got %d", len(members))
+	}
+	info, response, request := members[0], members[1], members[2]
+	if !strings.Contains(info, "WARC-Type: warcinfo\r\n") || !strings.Contains(info, "software: crawlergo\r\n") {
+		t.Errorf("Unexpected warcinfo record:\n%s", info)
+	}
+	for _, expected := range []string{
+		"WARC-Type: response\r\n",
+		"WARC-Target-URI: http://www.a.com/page?x=1\r\n",
+		"WARC-Truncated: length\r\n",
+		"Content-Type: application/http;msgtype=response\r\n",
+		"HTTP/1.1 200 OK\r\n",
+		"Content-Length: 18\r\n",
+		"\r\n\r\n<html>hello</html>\r\n\r\n",
+	} {
+		if !strings.Contains(response, expected) {
+			t.Errorf("The response record should contain %q:\n%s", expected, response)
+		}
+	}
+	if strings.Contains(response, "Content-Encoding") {
+		t.Error("The decoded response should not keep Content-Encoding.")
+	}
+	if !strings.Contains(request, "GET /page?x=1 HTTP/1.1\r\nHost: www.a.com\r\nUser-Agent: crawlergo\r\n") ||
+		!strings.Contains(request, "WARC-Warcinfo-ID: <urn:uuid:") {
+		t.Errorf("Unexpected request record:\n%s", request)
+	}
+}